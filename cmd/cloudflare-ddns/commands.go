@@ -0,0 +1,437 @@
+package main
+
+import (
+	"cloudflare-ddns/pkg/cache"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/config"
+	"cloudflare-ddns/pkg/history"
+	"cloudflare-ddns/pkg/journal"
+	"cloudflare-ddns/pkg/updater"
+	"cloudflare-ddns/pkg/zone"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	runCommand = config.Command{
+		Name:  "run",
+		Usage: "-token xxx -domain example.com -interval 5m",
+		Flags: config.UpdateFlags | config.DaemonFlags,
+	}
+	listCommand = config.Command{
+		Name:  "list",
+		Usage: "-token xxx -zone example.com [-name home.example.com] [-type A] [-format table|json|bind]",
+		Flags: config.ProviderFlags | config.ListFlags,
+	}
+	exportCommand = config.Command{
+		Name:  "export",
+		Usage: "-token xxx -zone example.com [-file example.com.json] [-format json|bind]",
+		Flags: config.ProviderFlags | config.SnapshotFlags,
+	}
+	importCommand = config.Command{
+		Name:  "import",
+		Usage: "-token xxx -zone example.com -file example.com.json [-format json|bind] [-restore]",
+		Flags: config.ProviderFlags | config.SnapshotFlags,
+	}
+	historyCommand = config.Command{
+		Name:  "history",
+		Usage: "[-domain example.com] [-type A] [-since 720h] [-until 2026-10-01]",
+		Flags: config.HistoryFlags | config.StateFlags,
+	}
+	undoCommand = config.Command{
+		Name:  "undo",
+		Usage: "-token xxx -domain example.com | -all",
+		Flags: config.ProviderFlags | config.RecordFlags | config.UndoFlags | config.StateFlags,
+	}
+	verifyCommand = config.Command{
+		Name:  "verify",
+		Usage: "-token xxx -domain example.com",
+		Flags: config.ProviderFlags | config.RecordFlags,
+	}
+	cacheShowCommand = config.Command{
+		Name:  "cache show",
+		Usage: "-domain example.com [-cache=redis://localhost:6379]",
+		Flags: config.RecordFlags | config.CacheFlags | config.StateFlags,
+	}
+	cacheClearCommand = config.Command{
+		Name:  "cache clear",
+		Usage: "-domain example.com [-cache=redis://localhost:6379]",
+		Flags: config.RecordFlags | config.CacheFlags | config.StateFlags,
+	}
+)
+
+// update points the record to the current IP once.
+func update(ctx context.Context, args []string) error {
+	cfg, err := config.Parse(args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	u, err := newUpdater(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	res := u.Update(ctx)
+	if res.Action == updater.Failed {
+		return fmt.Errorf("could not update %q: %s", res.Domain, explain(res.Err))
+	}
+	if res.Err != nil {
+		fmt.Println(res.Err)
+	}
+
+	fmt.Println(res)
+	return nil
+}
+
+// daemon updates the record every interval until it is stopped by a signal.
+// Failed updates are logged and retried on the next interval.
+func daemon(ctx context.Context, args []string) error {
+	cfg, err := config.ParseCommand(runCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	u, err := newUpdater(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("updating %q every %s", cfg.CloudFlare.Domain, cfg.App.Interval)
+	ticker := time.NewTicker(cfg.App.Interval)
+	defer ticker.Stop()
+
+	for {
+		res := u.Update(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		switch {
+		case res.Action == updater.Failed:
+			log.Printf("could not update %q: %s", res.Domain, explain(res.Err))
+		case res.Action != updater.Skipped, res.Locked:
+			if res.Err != nil {
+				log.Println(res.Err)
+			}
+			log.Println(res)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// list shows the records of a zone, or those matching the name and type filter.
+func list(ctx context.Context, args []string) error {
+	cfg, err := config.ParseCommand(listCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("could not initialize DNS provider: %w", err)
+	}
+
+	lister, ok := provider.(zone.Lister)
+	if !ok {
+		return fmt.Errorf("listing records is not supported with -provider %s", cfg.App.Provider)
+	}
+
+	filter := cloudflare.RecordFilter{Name: cfg.List.Name, Type: cloudflare.Type(cfg.List.Type)}
+	recs, err := lister.ListRecords(ctx, cfg.List.Zone, filter)
+	if err != nil {
+		return fmt.Errorf("could not list records of %q: %s", cfg.List.Zone, explain(err))
+	}
+
+	return zone.Write(os.Stdout, cfg.List.Zone, recs, cfg.List.Format)
+}
+
+// export writes every record of the zone to the snapshot file.
+func export(ctx context.Context, args []string) error {
+	cfg, err := config.ParseCommand(exportCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	restorer, err := newRestorer(cfg)
+	if err != nil {
+		return err
+	}
+
+	recs, err := restorer.ListRecords(ctx, cfg.Snapshot.Zone, cloudflare.RecordFilter{})
+	if err != nil {
+		return fmt.Errorf("could not list records of %q: %s", cfg.Snapshot.Zone, explain(err))
+	}
+
+	if cfg.Snapshot.File == "-" {
+		return zone.Write(os.Stdout, cfg.Snapshot.Zone, recs, cfg.Snapshot.Format)
+	}
+
+	f, err := os.OpenFile(cfg.Snapshot.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create snapshot: %w", err)
+	}
+
+	if err := zone.Write(f, cfg.Snapshot.Zone, recs, cfg.Snapshot.Format); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+
+	fmt.Printf("exported %d records of %q to %s\n", len(recs), cfg.Snapshot.Zone, cfg.Snapshot.File)
+	return nil
+}
+
+// restore shows the changes that restore the zone to the snapshot file, and applies them with -restore.
+func restore(ctx context.Context, args []string) error {
+	cfg, err := config.ParseCommand(importCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	restorer, err := newRestorer(cfg)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if cfg.Snapshot.File != "-" {
+		if in, err = os.Open(cfg.Snapshot.File); err != nil {
+			return fmt.Errorf("could not open snapshot: %w", err)
+		}
+		defer in.Close()
+	}
+
+	desired, err := zone.Read(in, cfg.Snapshot.Zone, cfg.Snapshot.Format)
+	if err != nil {
+		return fmt.Errorf("could not read snapshot: %w", err)
+	}
+
+	current, err := restorer.ListRecords(ctx, cfg.Snapshot.Zone, cloudflare.RecordFilter{})
+	if err != nil {
+		return fmt.Errorf("could not list records of %q: %s", cfg.Snapshot.Zone, explain(err))
+	}
+
+	changes := zone.Plan(current, desired)
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+
+	switch {
+	case len(changes) == 0:
+		fmt.Printf("%q matches the snapshot\n", cfg.Snapshot.Zone)
+		return nil
+	case !cfg.Snapshot.Restore:
+		fmt.Printf("dry run, %d changes not applied, run with -restore to apply them\n", len(changes))
+		return nil
+	}
+
+	applied, err := zone.Apply(ctx, restorer, changes)
+	if err != nil {
+		return fmt.Errorf("applied %d of %d changes: %s", applied, len(changes), explain(err))
+	}
+
+	fmt.Printf("applied %d changes to %q\n", applied, cfg.Snapshot.Zone)
+	return nil
+}
+
+// newRestorer returns the DNS provider of the configuration, if it can change any record of a zone.
+func newRestorer(cfg config.Configuration) (zone.Restorer, error) {
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize DNS provider: %w", err)
+	}
+
+	restorer, ok := provider.(zone.Restorer)
+	if !ok {
+		return nil, fmt.Errorf("snapshots are not supported with -provider %s", cfg.App.Provider)
+	}
+
+	return restorer, nil
+}
+
+// showHistory shows the events of the history matching the domain, type and time range.
+func showHistory(_ context.Context, args []string) error {
+	cfg, err := config.ParseCommand(historyCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	dir, err := cache.Dir(cfg.App.CacheDir)
+	if err != nil {
+		return err
+	}
+
+	events, err := history.New(dir).Events(history.Query{
+		Domain: cfg.History.Domain,
+		Type:   cloudflare.Type(cfg.History.Type),
+		Since:  cfg.History.Since,
+		Until:  cfg.History.Until,
+	})
+	if err != nil {
+		return err
+	}
+
+	return history.Write(os.Stdout, events)
+}
+
+// undo restores the content records had before their last journaled update.
+func undo(ctx context.Context, args []string) error {
+	cfg, err := config.ParseCommand(undoCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	dir, err := cache.Dir(cfg.App.CacheDir)
+	if err != nil {
+		return err
+	}
+	file := path.Join(dir, journal.Filename)
+	j := journal.New(file)
+
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+
+	filter := cloudflare.RecordFilter{}
+	if !cfg.Undo.All {
+		filter = cloudflare.RecordFilter{Name: cfg.CloudFlare.Domain, Type: cloudflare.Type(cfg.CloudFlare.Type)}
+	}
+
+	latest := journal.Latest(entries, filter)
+	if len(latest) == 0 {
+		return fmt.Errorf("no journaled updates to undo in %s", file)
+	}
+
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("could not initialize DNS provider: %w", err)
+	}
+
+	for _, e := range latest {
+		if err := j.Undo(ctx, provider, e, cfg.Undo.Force); err != nil {
+			return errors.New(explain(err))
+		}
+
+		fmt.Printf("restored %s record %q from %s to %s\n", e.Type, e.Name, e.New, e.Old)
+	}
+
+	return nil
+}
+
+// preflight verifies the credentials once before the first update, unless -preflight=false is given.
+// Credentials that are invalid or lack permissions fail it, while permissions CloudFlare does not
+// report are only warned about, as the update may still succeed.
+func preflight(ctx context.Context, cfg config.Configuration, provider updater.DNSProvider) error {
+	verifier, ok := provider.(updater.Verifier)
+	if !ok || !cfg.App.Preflight {
+		return nil
+	}
+
+	v := verifier.Verify(ctx, cfg.CloudFlare.Domain)
+	if v.Err != nil || len(v.Missing) > 0 {
+		return fmt.Errorf("preflight check failed, not updating:\n%s", v)
+	}
+	if len(v.Unverified) > 0 {
+		log.Printf("could not verify the permissions %s on %q, as CloudFlare did not report them, updates may be refused",
+			strings.Join(v.Unverified, ", "), v.Domain)
+	}
+
+	return nil
+}
+
+// verify checks the credentials against the configured domain and fails if they cannot update it.
+func verify(ctx context.Context, args []string) error {
+	cfg, err := config.ParseCommand(verifyCommand, args)
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	if cfg.App.Provider != config.ProviderCloudFlare {
+		return fmt.Errorf("verify is only supported with -provider %s", config.ProviderCloudFlare)
+	}
+
+	cf, err := newClient(cfg.CloudFlare)
+	if err != nil {
+		return fmt.Errorf("could not initialize CloudFlare client: %w", err)
+	}
+
+	v := cf.Verify(ctx, cfg.CloudFlare.Domain)
+	fmt.Print(v)
+	if !v.OK() {
+		return fmt.Errorf("the credentials cannot update %q", v.Domain)
+	}
+
+	return nil
+}
+
+// cacheCommand shows or clears the cached record.
+func cacheCommand(_ context.Context, args []string) error {
+	if len(args) == 0 || (args[0] != "show" && args[0] != "clear") {
+		return errors.New("cache requires a subcommand, either \"show\" or \"clear\"")
+	}
+
+	cmd := cacheShowCommand
+	if args[0] == "clear" {
+		cmd = cacheClearCommand
+	}
+
+	cfg, err := config.ParseCommand(cmd, args[1:])
+	if err != nil {
+		return fmt.Errorf("could not parse flags: %w", err)
+	}
+
+	// The cache is shown or cleared even if -cache is not given, which selects the JSON files.
+	c, err := cache.Factory(true, cfg.App.CacheURL, cfg.App.CacheDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Name == cacheClearCommand.Name {
+		deleter, ok := c.(cache.Deleter)
+		if !ok {
+			return fmt.Errorf("the cache cannot be cleared")
+		}
+
+		if err := deleter.DeleteRecord(cfg.CloudFlare.Domain, cfg.CloudFlare.Type); err != nil {
+			return err
+		}
+
+		fmt.Printf("cleared cached %s record of %q\n", cfg.CloudFlare.Type, cfg.CloudFlare.Domain)
+		return nil
+	}
+
+	rec, err := c.GetRecord(cfg.CloudFlare.Domain, cfg.CloudFlare.Type)
+	if err != nil {
+		return fmt.Errorf("no cached %s record of %q: %w", cfg.CloudFlare.Type, cfg.CloudFlare.Domain, err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rec)
+}
+
+// printVersion prints the version and commit the binary was built from.
+func printVersion(_ context.Context, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("version takes no arguments")
+	}
+
+	fmt.Printf("%s, commit %q\n", version, commit)
+	return nil
+}
@@ -4,74 +4,205 @@ import (
 	"cloudflare-ddns/pkg/cache"
 	"cloudflare-ddns/pkg/cloudflare"
 	"cloudflare-ddns/pkg/config"
+	"cloudflare-ddns/pkg/history"
 	"cloudflare-ddns/pkg/ip"
+	"cloudflare-ddns/pkg/journal"
+	"cloudflare-ddns/pkg/rfc2136"
+	"cloudflare-ddns/pkg/updater"
 	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 )
 
 var (
 	version = "v0.0.0-dev"
 	commit  = ""
+
+	// newRetriever returns the retriever of the IP, replaced by tests with a scripted one.
+	newRetriever = ip.Factory
 )
 
+// command is a subcommand of the binary.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// commands returns the subcommands in the order they are listed in the usage.
+func commands() []command {
+	return []command{
+		{name: "update", summary: "Point the record to the current IP once, the default when only flags are given", run: update},
+		{name: "run", summary: "Keep the record pointing to the current IP, checking it periodically", run: daemon},
+		{name: "list", summary: "Show the records of a zone as a table, JSON or BIND zone file", run: list},
+		{name: "export", summary: "Write every record of a zone to a JSON or BIND snapshot", run: export},
+		{name: "import", summary: "Show the changes restoring a zone to a snapshot, and apply them with -restore", run: restore},
+		{name: "history", summary: "Show the observed IPs and update outcomes, filtered by domain and time range", run: showHistory},
+		{name: "undo", summary: "Restore the content a record had before its last update, or of every record with -all", run: undo},
+		{name: "verify", summary: "Check that the credentials can update the domain", run: verify},
+		{name: "cache", summary: "Show or clear the cached record, as \"cache show\" or \"cache clear\"", run: cacheCommand},
+		{name: "version", summary: "Print the version", run: printVersion},
+	}
+}
+
 func main() {
-	if len(os.Args) == 2 && (os.Args[1] == "-v" || os.Args[1] == "version") {
-		fmt.Printf("%s, commit %q\n", version, commit)
+	args := os.Args[1:]
+	name := "update"
+	switch {
+	case len(args) == 0:
+		usage()
+		os.Exit(2)
+	case args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+		usage()
 		return
+	case args[0] == "-v":
+		name, args = "version", args[1:]
+	case strings.HasPrefix(args[0], "-"):
+		// Flags without a command update the record, as before there were subcommands.
+	default:
+		name, args = args[0], args[1:]
 	}
 
-	cfg, err := config.Parse(os.Args[1:])
-	if err != nil {
-		log.Fatalf("could not parse flags: %s", err)
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+
+		ctx, cancel := signalContext()
+		err := cmd.run(ctx, args)
+		cancel()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	usage()
+	log.Fatalf("unknown command %q", name)
+}
 
-	retriever := ip.Factory(cfg.App.Interface)
-	myIP, err := retriever.Get(cfg.CloudFlare.IPVersion)
-	if err != nil {
-		log.Fatalf("could not get IP: %s", err)
+// usage prints the commands of the binary.
+func usage() {
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "USAGE:\n\t%s <command> [flags]\n\nCOMMANDS:\n", os.Args[0])
+	for _, cmd := range commands() {
+		_, _ = fmt.Fprintf(w, "\t%s\t%s\n", cmd.name, cmd.summary)
 	}
+	_, _ = fmt.Fprintf(w, "\nRun \"%s <command> -h\" for the flags of a command.\n", os.Args[0])
+	_ = w.Flush()
+}
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
 
-	cacher := cache.Factory(cfg.App.CacheEnabled)
-	cached, err := cacher.GetRecord(cfg.CloudFlare.Domain, cfg.CloudFlare.Type)
+	return ctx, cancel
+}
+
+// newUpdater returns an updater for the configuration, once the preflight check passed.
+func newUpdater(ctx context.Context, cfg config.Configuration) (*updater.Updater, error) {
+	provider, err := newProvider(cfg)
 	if err != nil {
-		fmt.Printf("error while getting cache: %s\n", err)
+		return nil, fmt.Errorf("could not initialize DNS provider: %w", err)
 	}
 
-	if myIP == cached.Content {
-		fmt.Println("no changes in IP, skipping update")
-		return
+	if err := preflight(ctx, cfg, provider); err != nil {
+		return nil, err
 	}
 
-	cf, err := cloudflare.NewClient(
-		cfg.CloudFlare.Token,
-		cloudflare.Timeout(cfg.CloudFlare.Timeout),
-		cloudflare.Retry(3),
-	)
+	var options []func(*updater.Updater)
+	dir, err := cache.Dir(cfg.App.CacheDir)
 	if err != nil {
-		log.Fatalf("could not initialize CloudFlare client: %s", err)
+		log.Printf("not keeping a journal and history of updates: %s", err)
+	} else {
+		options = append(options,
+			updater.Journal(journal.New(path.Join(dir, journal.Filename))),
+			updater.History(history.New(dir)),
+		)
 	}
 
-	rec, err := cf.GetRecord(ctx, cfg.CloudFlare.Domain, cloudflare.Type(cfg.CloudFlare.Type))
+	cacher, err := cache.Factory(cfg.App.CacheEnabled, cfg.App.CacheURL, cfg.App.CacheDir)
 	if err != nil {
-		log.Fatalf("could not get CloudFlare record: %s", err)
+		return nil, fmt.Errorf("could not initialize cache: %w", err)
+	}
+
+	// Without a cache that locks records, they are locked with files in the cache directory,
+	// so overlapping runs never update the same record at the same time.
+	if _, ok := cacher.(updater.Locker); !ok && dir != "" {
+		options = append(options, updater.Lock(cache.New(dir)))
 	}
-	if err := cacher.SaveRecord(rec); err != nil {
-		fmt.Printf("could not save cached record: %s\n", err)
+
+	return updater.New(newRetriever(cfg.App.Interface), cacher, provider, cfg, options...), nil
+}
+
+// newProvider returns the DNS provider the configured record is published to.
+func newProvider(cfg config.Configuration) (updater.DNSProvider, error) {
+	if cfg.App.Provider == config.ProviderRFC2136 {
+		options := []func(*rfc2136.Client){rfc2136.Timeout(cfg.CloudFlare.Timeout)}
+		if cfg.RFC2136.Zone != "" {
+			options = append(options, rfc2136.Zone(cfg.RFC2136.Zone))
+		}
+		if cfg.RFC2136.TSIGKey != "" {
+			options = append(options, rfc2136.TSIG(cfg.RFC2136.TSIGKey, cfg.RFC2136.TSIGSecret, cfg.RFC2136.TSIGAlgorithm))
+		}
+
+		return rfc2136.NewClient(cfg.RFC2136.Nameserver, options...)
+	}
+
+	return newClient(cfg.CloudFlare)
+}
+
+// newClient returns a CloudFlare client for the configuration.
+func newClient(cfg config.CloudFlare) (*cloudflare.API, error) {
+	return cloudflare.NewClient(
+		cloudflare.Authentication(authenticator(cfg)),
+		cloudflare.BaseURL(cfg.BaseURL),
+		cloudflare.Timeout(cfg.Timeout),
+		cloudflare.Retry(3),
+	)
+}
+
+// authenticator returns the CloudFlare authentication strategy selected by the configuration.
+func authenticator(cfg config.CloudFlare) cloudflare.Authenticator {
+	if cfg.Auth == config.AuthKey {
+		return cloudflare.GlobalKey{Email: cfg.Email, Key: cfg.Key}
 	}
 
-	if err := cf.UpdateRecord(ctx, rec.ID, cloudflare.DNSUpdateRequest{
-		Name:    rec.Name,
-		Type:    rec.Type,
-		Content: myIP,
-		Proxied: cfg.CloudFlare.Proxied,
-	}); err != nil {
-		log.Fatalf("could not update record: %s ", err)
+	if len(cfg.ZoneTokens) > 0 {
+		return cloudflare.ZoneTokens{Tokens: cfg.ZoneTokens, Default: cfg.Token}
 	}
 
-	fmt.Printf("Updated %q to point from %s to %s\n", cfg.CloudFlare.Domain, rec.Content, myIP)
+	return cloudflare.BearerToken(cfg.Token)
+}
+
+// explain returns the error message with a hint for errors the user can act upon.
+func explain(err error) string {
+	switch {
+	case cloudflare.IsAuthError(err):
+		return fmt.Sprintf("%s (CloudFlare rejected the credentials, run \"%s verify\" to check them)", err, os.Args[0])
+	case cloudflare.IsRateLimited(err):
+		return fmt.Sprintf("%s (rate limited by CloudFlare, try again later)", err)
+	case rfc2136.IsAuthError(err):
+		return fmt.Sprintf("%s (the name server refused the update, check the -tsig-* parameters and its update policy)", err)
+	case rfc2136.IsConflict(err):
+		return fmt.Sprintf("%s (the record changed on the name server while updating, try again)", err)
+	default:
+		return err.Error()
+	}
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/ip"
+	"cloudflare-ddns/pkg/test"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	defer func(f func(string) ip.Retriever) { newRetriever = f }(newRetriever)
+	newRetriever = func(string) ip.Retriever {
+		return test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2")})
+	}
+
+	tests := []struct {
+		name      string
+		auth      []string
+		configure func(fake *test.CloudFlare)
+		wantErr   bool
+	}{
+		{
+			name: "API token",
+			auth: []string{"-token", "token"},
+		},
+		{
+			name:      "Global API Key",
+			auth:      []string{"-auth", "key", "-email", "me@nenad.dev", "-key", "key"},
+			configure: func(fake *test.CloudFlare) { fake.GlobalKey("me@nenad.dev", "key") },
+		},
+		{
+			name:      "token of the zone",
+			auth:      []string{"-zone-token", "nenad.dev=zone-token"},
+			configure: func(fake *test.CloudFlare) { fake.ZoneToken("nenad.dev", "zone-token") },
+		},
+		{
+			name:      "permissions not reported by CloudFlare",
+			auth:      []string{"-token", "token", "-preflight"},
+			configure: func(fake *test.CloudFlare) { fake.Permissions("nenad.dev", nil) },
+		},
+		{
+			name:      "missing permissions",
+			auth:      []string{"-token", "token", "-preflight"},
+			configure: func(fake *test.CloudFlare) { fake.Permissions("nenad.dev", []string{"#zone:read"}) },
+			wantErr:   true,
+		},
+		{
+			name:      "token of another zone",
+			auth:      []string{"-zone-token", "nenad.dev=zone-token"},
+			configure: func(fake *test.CloudFlare) { fake.ZoneToken("hello.dev", "zone-token") },
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cloudflare-ddns")
+			if err != nil {
+				t.Fatalf("could not create directory: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			fake := test.NewCloudFlare("token")
+			defer fake.Close()
+			fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Tags: []string{"cloudflare-ddns:router"}})
+			if tt.configure != nil {
+				tt.configure(fake)
+			}
+
+			args := append([]string{"-domain", "home.nenad.dev", "-api-url", fake.URL(), "-owner", "router", "-cache", "-cache-dir", dir}, tt.auth...)
+			err = update(context.Background(), args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %t, got %v", tt.wantErr, err)
+			}
+
+			want := "192.168.0.2"
+			if tt.wantErr {
+				want = "192.168.0.1"
+			}
+			if recs := fake.Records("nenad.dev"); len(recs) != 1 || recs[0].Content != want {
+				t.Errorf("expected the record to point to %s, got %v", want, recs)
+			}
+		})
+	}
+}
@@ -2,4 +2,8 @@ module cloudflare-ddns
 
 go 1.14
 
-require golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e
+require (
+	github.com/miekg/dns v1.1.29
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e
+)
@@ -0,0 +1,304 @@
+package cache_test
+
+import (
+	"cloudflare-ddns/pkg/cache"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/test"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backend is a cache backend under test.
+type backend interface {
+	cache.Cacher
+	cache.Deleter
+}
+
+func TestBackends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	redis, err := test.NewRedis("secret")
+	if err != nil {
+		t.Fatalf("could not start redis: %s", err)
+	}
+	defer redis.Close()
+
+	backends := map[string]backend{
+		"file":  cache.New(path.Join(dir, "files")),
+		"bolt":  cache.NewBolt(path.Join(dir, "cache.db")),
+		"redis": cache.NewRedis(redis.Addr(), cache.RedisPassword("secret"), cache.RedisDB(2)),
+	}
+
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			testBackend(t, c)
+		})
+	}
+
+	if fields := redis.Hash("2/cloudflare-ddns:records"); len(fields) != 0 {
+		t.Errorf("expected the record to be deleted from redis, got %v", fields)
+	}
+}
+
+// testBackend saves, replaces and deletes an entry in the backend, which must not hold it yet.
+func testBackend(t *testing.T, c backend) {
+	want := cache.NewEntry(cloudflare.Record{ID: "f0764281", ZoneID: "023e105f", Type: cloudflare.A, Name: "*.nenad.dev", Content: "192.168.0.1", TTL: 1}, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	if _, err := c.GetRecord(want.Name, string(want.Type)); err == nil {
+		t.Fatalf("expected an error for a missing record")
+	}
+
+	if err := c.SaveRecord(want); err != nil {
+		t.Fatalf("could not save record: %s", err)
+	}
+
+	got, err := c.GetRecord(want.Name, string(want.Type))
+	if err != nil {
+		t.Fatalf("could not get record: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("records don't match. want %#v, got %#v", want, got)
+	}
+
+	failed := want
+	failed.Error = "could not update record"
+	if err := c.SaveRecord(failed); err != nil {
+		t.Fatalf("could not save record: %s", err)
+	}
+	if got, err := c.GetRecord(want.Name, string(want.Type)); err != nil || got.Error != failed.Error {
+		t.Fatalf("expected the entry to be replaced, got %#v (%v)", got, err)
+	}
+
+	// A record that was recreated with another ID replaces the entry of the earlier one.
+	recreated := want
+	recreated.RecordID = "372e6795"
+	if err := c.SaveRecord(recreated); err != nil {
+		t.Fatalf("could not save record: %s", err)
+	}
+	if got, err := c.GetRecord(want.Name, string(want.Type)); err != nil || !reflect.DeepEqual(got, recreated) {
+		t.Fatalf("expected the entry of the recreated record, got %#v (%v)", got, err)
+	}
+
+	if _, err := c.GetRecord(want.Name, "AAAA"); err == nil {
+		t.Errorf("expected records of other types not to be cached")
+	}
+
+	if err := c.DeleteRecord(want.Name, string(want.Type)); err != nil {
+		t.Fatalf("could not delete record: %s", err)
+	}
+	if _, err := c.GetRecord(want.Name, string(want.Type)); err == nil {
+		t.Errorf("expected the deleted record to be gone")
+	}
+	if err := c.DeleteRecord(want.Name, string(want.Type)); err != nil {
+		t.Errorf("deleting a missing record should not fail: %s", err)
+	}
+}
+
+func TestCache_Migrate(t *testing.T) {
+	dir := tempDir(t)
+
+	// Earlier versions cached the record itself under the domain and record type.
+	legacy := `{"id":"f0764281","zone_id":"023e105f","type":"A","name":"home.nenad.dev","content":"192.168.0.1","proxied":true,"ttl":1}`
+	if err := ioutil.WriteFile(path.Join(dir, "home.nenad.dev-A.json"), []byte(legacy), 0600); err != nil {
+		t.Fatalf("could not write cache file: %s", err)
+	}
+
+	c := cache.New(dir)
+	want := cache.Entry{Version: cache.Version, ZoneID: "023e105f", RecordID: "f0764281", Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", TTL: 1, Proxied: true}
+	for i := 0; i < 2; i++ {
+		got, err := c.GetRecord("home.nenad.dev", "A")
+		if err != nil {
+			t.Fatalf("could not get record: %s", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("records don't match. want %#v, got %#v", want, got)
+		}
+	}
+
+	if err := c.DeleteRecord("home.nenad.dev", "A"); err != nil {
+		t.Fatalf("could not delete record: %s", err)
+	}
+	if _, err := c.GetRecord("home.nenad.dev", "A"); err == nil {
+		t.Errorf("expected the migrated record to be deleted")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the legacy file to be replaced and deleted, got %d files", len(files))
+	}
+}
+
+func TestBackends_NewerVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	newer := fmt.Sprintf(`{"version":%d,"zone_id":"023e105f","record_id":"f0764281","name":"home.nenad.dev","type":"A"}`, cache.Version+1)
+	if err := ioutil.WriteFile(path.Join(dir, "home.nenad.dev-A.json"), []byte(newer), 0600); err != nil {
+		t.Fatalf("could not write cache file: %s", err)
+	}
+
+	if _, err := cache.New(dir).GetRecord("home.nenad.dev", "A"); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected an error for an entry of a newer version, got %v", err)
+	}
+	if _, err := cache.New(dir).GetRecord("other.nenad.dev", "A"); err == nil || strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected entries of other records to be ignored, got %v", err)
+	}
+}
+
+func TestRedisCache_Lock(t *testing.T) {
+	redis, err := test.NewRedis("")
+	if err != nil {
+		t.Fatalf("could not start redis: %s", err)
+	}
+	defer redis.Close()
+
+	testRedisLock(t, redis.Addr(), "ddns:")
+
+	c := cache.NewRedis(redis.Addr(), cache.RedisPrefix("ddns:"), cache.RedisLockTTL(300*time.Millisecond))
+	unlock, err := c.Lock("home.nenad.dev", "A")
+	if err != nil {
+		t.Fatalf("could not lock record: %s", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("could not unlock record: %s", err)
+	}
+	if _, ok := redis.Get("0/ddns:home.nenad.dev/A:lock"); ok {
+		t.Fatalf("expected the lock to be removed")
+	}
+
+	// A lock that expired and was taken over by another instance is kept, and reported as lost.
+	if unlock, err = c.Lock("home.nenad.dev", "A"); err != nil {
+		t.Fatalf("could not lock record: %s", err)
+	}
+	redis.Set("0/ddns:home.nenad.dev/A:lock", "other")
+	time.Sleep(200 * time.Millisecond)
+	if err := unlock(); err == nil {
+		t.Errorf("expected an error for a lost lock")
+	}
+	if token, ok := redis.Get("0/ddns:home.nenad.dev/A:lock"); !ok || token != "other" {
+		t.Fatalf("expected the lock of the other instance to be kept, got %q", token)
+	}
+}
+
+// TestRedisServer runs the tests of the Redis cache against the server at $REDIS_ADDR, as host:port,
+// as the test server only understands the commands and scripts the cache is known to send.
+func TestRedisServer(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+
+	prefix := fmt.Sprintf("cloudflare-ddns-test:%d:", time.Now().UnixNano())
+	testBackend(t, cache.NewRedis(addr, cache.RedisPrefix(prefix)))
+	testRedisLock(t, addr, prefix)
+}
+
+// testRedisLock locks a record on the server at the address for longer than the lock lives,
+// expecting it to be kept until it is unlocked.
+func testRedisLock(t *testing.T, addr, prefix string) {
+	c := cache.NewRedis(addr, cache.RedisPrefix(prefix), cache.RedisLockTTL(300*time.Millisecond))
+	unlock, err := c.Lock("home.nenad.dev", "A")
+	if err != nil {
+		t.Fatalf("could not lock record: %s", err)
+	}
+
+	// Updates with slow requests and retries take longer than the lock lives, so it is refreshed while held.
+	time.Sleep(time.Second)
+	if _, err := cache.NewRedis(addr, cache.RedisPrefix(prefix)).Lock("home.nenad.dev", "A"); !errors.Is(err, cache.ErrLocked) {
+		t.Fatalf("expected the record to be locked for other instances, got %v", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("could not unlock record: %s", err)
+	}
+	if unlock, err = cache.NewRedis(addr, cache.RedisPrefix(prefix)).Lock("home.nenad.dev", "A"); err != nil {
+		t.Fatalf("expected the record to be unlocked, got %s", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("could not unlock record: %s", err)
+	}
+}
+
+func TestBoltCache_Lock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := path.Join(dir, "cache.db")
+	unlock, err := cache.NewBolt(db).Lock("home.nenad.dev", "A")
+	if err != nil {
+		t.Fatalf("could not lock record: %s", err)
+	}
+
+	if _, err := cache.NewBolt(db).Lock("home.nenad.dev", "A"); !errors.Is(err, cache.ErrLocked) {
+		t.Fatalf("expected the record to be locked, got %v", err)
+	}
+
+	// The database stays usable while the record is locked.
+	if err := cache.NewBolt(db).SaveRecord(cache.Entry{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1"}); err != nil {
+		t.Fatalf("could not save locked record: %s", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("could not unlock record: %s", err)
+	}
+	if unlock, err = cache.NewBolt(db).Lock("home.nenad.dev", "A"); err != nil {
+		t.Fatalf("expected the record to be unlocked, got %s", err)
+	}
+	_ = unlock()
+}
+
+func TestRedisCache_WrongPassword(t *testing.T) {
+	redis, err := test.NewRedis("secret")
+	if err != nil {
+		t.Fatalf("could not start redis: %s", err)
+	}
+	defer redis.Close()
+
+	err = cache.NewRedis(redis.Addr(), cache.RedisPassword("wrong")).SaveRecord(cache.Entry{Name: "nenad.dev", Type: cloudflare.A})
+	var redisErr *cache.RedisError
+	if !errors.As(err, &redisErr) {
+		t.Fatalf("expected a redis error, got %v", err)
+	}
+}
+
+func TestFactory(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    interface{}
+		wantErr bool
+	}{
+		{url: "", want: &cache.Cache{}},
+		{url: "file:///var/cache/cloudflare-ddns", want: &cache.Cache{}},
+		{url: "bolt:///var/cache/cloudflare-ddns/cache.db", want: &cache.BoltCache{}},
+		{url: "redis://:secret@localhost/1?prefix=ddns:", want: &cache.RedisCache{}},
+		{url: "redis://localhost/first", wantErr: true},
+		{url: "memcached://localhost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := cache.Factory(true, tt.url, "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Factory(%q) error = %v, want error %t", tt.url, err, tt.wantErr)
+		} else if !tt.wantErr && reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+			t.Errorf("Factory(%q) = %T, want %T", tt.url, got, tt.want)
+		}
+	}
+
+	if got, _ := cache.Factory(false, "redis://localhost", ""); reflect.TypeOf(got) != reflect.TypeOf(&cache.NoopCache{}) {
+		t.Errorf("expected a disabled cache to cache nothing, got %T", got)
+	}
+}
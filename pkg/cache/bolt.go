@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// recordsBucket is the bucket of the bolt database holding the records.
+var recordsBucket = []byte("records")
+
+// BoltCache keeps the records in an embedded bbolt database, by their name and type.
+// The database is only opened while reading or writing a record, as bbolt locks it against every other process.
+type BoltCache struct {
+	path    string
+	timeout time.Duration
+}
+
+// NewBolt returns a cache keeping records in the bbolt database at the path, creating it if needed.
+func NewBolt(path string) *BoltCache {
+	return &BoltCache{path: path, timeout: 10 * time.Second}
+}
+
+// GetRecord returns the entry of the record.
+func (c *BoltCache) GetRecord(domain, recordType string) (e Entry, err error) {
+	err = c.view(func(b *bolt.Bucket) error {
+		e, err = decodeStored(b.Get([]byte(entryKey(domain, recordType))), domain, recordType)
+		return err
+	})
+
+	return e, err
+}
+
+func (c *BoltCache) SaveRecord(e Entry) error {
+	e.Version = Version
+	value, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not marshal record: %w", err)
+	}
+
+	return c.update(func(b *bolt.Bucket) error {
+		return b.Put([]byte(e.Key()), value)
+	})
+}
+
+// Lock locks the record against updates by other processes and other Lock calls, until the returned
+// function unlocks it. The lock is a file next to the database, as the database itself is only opened
+// while reading or writing. It does not wait for the lock, returning ErrLocked if the record is already locked.
+func (c *BoltCache) Lock(domain, recordType string) (func() error, error) {
+	return lockFile(fmt.Sprintf("%s.%s-%s.lock", c.path, sanitize(domain), sanitize(recordType)))
+}
+
+// DeleteRecord removes the cached entry of the record, it is not an error if there is none.
+func (c *BoltCache) DeleteRecord(domain, recordType string) error {
+	return c.update(func(b *bolt.Bucket) error {
+		return b.Delete([]byte(entryKey(domain, recordType)))
+	})
+}
+
+func (c *BoltCache) view(fn func(b *bolt.Bucket) error) error {
+	return c.open(func(db *bolt.DB) error {
+		return db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(recordsBucket)
+			if b == nil {
+				return errors.New("no cached records")
+			}
+
+			return fn(b)
+		})
+	})
+}
+
+func (c *BoltCache) update(fn func(b *bolt.Bucket) error) error {
+	return c.open(func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(recordsBucket)
+			if err != nil {
+				return err
+			}
+
+			return fn(b)
+		})
+	})
+}
+
+func (c *BoltCache) open(fn func(db *bolt.DB) error) (err error) {
+	db, err := bolt.Open(c.path, 0600, &bolt.Options{Timeout: c.timeout})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("could not open cache database, its directory does not exist: %w", err)
+		}
+		return fmt.Errorf("could not open cache database: %w", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("could not close cache database: %w", closeErr)
+		}
+	}()
+
+	return fn(db)
+}
@@ -1,75 +1,339 @@
 package cache
 
 import (
-	"cloudflare-ddns/pkg/cloudflare"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
 	"os"
 	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// Cacher keeps the state of the managed records between runs, keyed by their name and type,
+// as those are what is configured. The zone and record ID are kept in the entry.
 type Cacher interface {
-	GetRecord(domain, recordType string) (cloudflare.Record, error)
-	SaveRecord(record cloudflare.Record) error
+	GetRecord(domain, recordType string) (Entry, error)
+	SaveRecord(e Entry) error
 }
 
-type Cache struct{}
+// Cache keeps every record in its own JSON file in the cache directory, named after its name and type,
+// so a record is looked up without reading the files of other records.
+type Cache struct {
+	dir string
+}
 
-func Factory(enabled bool) Cacher {
-	if !enabled {
-		return &NoopCache{}
-	}
+var (
+	_ Deleter = (*Cache)(nil)
+	_ Deleter = (*BoltCache)(nil)
+	_ Deleter = (*RedisCache)(nil)
+)
+
+// ErrLocked is returned by Lock if another process or call holds the lock of the record.
+var ErrLocked = errors.New("the record is being updated by another process")
 
-	return &Cache{}
+// New returns a cache keeping records in the directory, or in the default directory if it is empty.
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
 }
 
-func (c *Cache) GetRecord(domain, recordType string) (rec cloudflare.Record, err error) {
-	filename, err := getFilename(domain, recordType)
-	if err != nil {
-		return rec, fmt.Errorf("could not get filename: %w", err)
+// Deleter is implemented by caches that can remove a cached record.
+type Deleter interface {
+	DeleteRecord(domain, recordType string) error
+}
+
+// Factory returns the cache selected by the URL, or a cache that caches nothing if it is not enabled.
+// The URL is one of
+//
+//	file:///var/cache/cloudflare-ddns, or empty for JSON files in the directory dir
+//	bolt:///var/cache/cloudflare-ddns/cache.db, or bolt: for cache.db in the directory dir
+//	redis://:password@localhost:6379/0?prefix=cloudflare-ddns:
+func Factory(enabled bool, cacheURL, dir string) (Cacher, error) {
+	if !enabled {
+		return &NoopCache{}, nil
 	}
-	cacheBytes, err := ioutil.ReadFile(filename)
+	if cacheURL == "" {
+		return New(dir), nil
+	}
+
+	u, err := url.Parse(cacheURL)
 	if err != nil {
-		return rec, fmt.Errorf("could not read cache file: %w", err)
+		return nil, fmt.Errorf("could not parse cache URL: %w", err)
 	}
 
-	if err := json.Unmarshal(cacheBytes, &rec); err != nil {
-		return rec, fmt.Errorf("could not unmarshal cached record: %w", err)
+	switch u.Scheme {
+	case "file":
+		if u.Path != "" {
+			dir = u.Path
+		}
+		return New(dir), nil
+	case "bolt", "bbolt":
+		if u.Path != "" {
+			return NewBolt(u.Path), nil
+		}
+
+		if dir, err = Dir(dir); err != nil {
+			return nil, err
+		}
+		return NewBolt(path.Join(dir, "cache.db")), nil
+	case "redis":
+		options := []func(*RedisCache){}
+		if password, ok := u.User.Password(); ok {
+			options = append(options, RedisPassword(password))
+		}
+		if db := strings.Trim(u.Path, "/"); db != "" {
+			n, err := strconv.Atoi(db)
+			if err != nil {
+				return nil, fmt.Errorf("redis database must be a number, got %q", db)
+			}
+			options = append(options, RedisDB(n))
+		}
+		if prefix, ok := u.Query()["prefix"]; ok {
+			options = append(options, RedisPrefix(prefix[0]))
+		}
+
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "6379")
+		}
+		return NewRedis(addr, options...), nil
+	default:
+		return nil, fmt.Errorf("unknown cache %q, must be a file, bolt or redis URL", cacheURL)
+	}
+}
+
+// GetRecord returns the entry of the record, migrating the file of an earlier version on the way.
+func (c *Cache) GetRecord(domain, recordType string) (e Entry, err error) {
+	e, err = c.read(domain, recordType)
+	if errors.Is(err, os.ErrNotExist) {
+		return e, fmt.Errorf("no cached %s record of %q", recordType, domain)
 	}
 
-	return rec, nil
+	return e, err
 }
 
-func (c *Cache) SaveRecord(rec cloudflare.Record) error {
-	filename, err := getFilename(rec.Name, string(rec.Type))
+// SaveRecord writes the entry to a temporary file and renames it over the cached one, so readers
+// and concurrent writers never see a partially written entry, even if the process crashes.
+func (c *Cache) SaveRecord(e Entry) error {
+	e.Version = Version
+	filename, err := c.path(e)
 	if err != nil {
 		return fmt.Errorf("could not get filename: %w", err)
 	}
 
-	cacheFile, err := os.Create(filename)
+	tmp, err := ioutil.TempFile(path.Dir(filename), path.Base(filename)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("could not open file for writing: %w", err)
 	}
+	defer os.Remove(tmp.Name())
 
-	if err := json.NewEncoder(cacheFile).Encode(rec); err != nil {
+	if err := json.NewEncoder(tmp).Encode(e); err != nil {
+		_ = tmp.Close()
 		return fmt.Errorf("could not marshal record to file: %w", err)
 	}
 
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("could not write cache file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write cache file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("could not replace cache file: %w", err)
+	}
+
+	return syncDir(path.Dir(filename))
+}
+
+// Lock locks the record against updates by other processes and other Lock calls, until the returned
+// function unlocks it. It does not wait for the lock, returning ErrLocked if the record is already locked.
+func (c *Cache) Lock(domain, recordType string) (func() error, error) {
+	filename, err := c.filename(domain, recordType, ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("could not get filename: %w", err)
+	}
+
+	// The lock has its own file, as the cache file is replaced on every save.
+	return lockFile(filename)
+}
+
+// lockFile locks the file, creating it if needed, until the returned function unlocks it.
+func lockFile(filename string) (func() error, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file: %w", err)
+	}
+
+	if err := lock(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() error {
+		if err := unlock(f); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("could not unlock record: %w", err)
+		}
+
+		return f.Close()
+	}, nil
+}
+
+// DeleteRecord removes the cached entry of the record, it is not an error if there is none.
+// A file that does not hold an entry of the record is kept, as it was not written by the cache.
+func (c *Cache) DeleteRecord(domain, recordType string) error {
+	if _, err := c.read(domain, recordType); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	filename, err := c.filename(domain, recordType, ".json")
+	if err != nil {
+		return fmt.Errorf("could not get filename: %w", err)
+	}
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove cache file: %w", err)
+	}
+
 	return nil
 }
 
-func getFilename(domain, recordType string) (string, error) {
+// read returns the entry in the file of the record. Files of earlier versions, which have the same name
+// and hold the record itself, are rewritten as entries of the current version.
+func (c *Cache) read(domain, recordType string) (e Entry, err error) {
+	filename, err := c.filename(domain, recordType, ".json")
+	if err != nil {
+		return e, fmt.Errorf("could not get filename: %w", err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return e, fmt.Errorf("could not read cache file: %w", err)
+	}
+
+	e, migrated, err := decodeEntry(data)
+	if err != nil {
+		return e, fmt.Errorf("could not read cache file %s: %w", filename, err)
+	}
+	if !e.Matches(domain, recordType) {
+		return e, fmt.Errorf("cache file %s does not hold the %s record of %q", filename, recordType, domain)
+	}
+
+	if migrated {
+		if err := c.SaveRecord(e); err != nil {
+			return e, fmt.Errorf("could not migrate cache file: %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+// Dir returns the directory, or the default directory if it is empty, creating it readable only by its owner
+// if needed. Other state of the application, such as the journal, is kept in it as well.
+//
+// Existing directories keep their mode, as they may be shared, such as /tmp, with a warning if others can
+// access them. Only cloudflare-ddns in the user's cache directory, which earlier
+// versions created readable by everyone, is made private.
+func Dir(dir string) (string, error) {
+	given := dir != ""
+	if !given {
+		var err error
+		if dir, err = DefaultDir(); err != nil {
+			return "", err
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("could not create cache directory: %w", err)
+		}
+		return dir, nil
+	} else if err != nil {
+		return "", fmt.Errorf("could not read cache directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("cache directory %s is not a directory", dir)
+	}
+	if runtime.GOOS == "windows" || info.Mode().Perm()&0077 == 0 {
+		return dir, nil
+	}
+
+	if own, err := userDir(); !given && err == nil && dir == own {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", fmt.Errorf("could not make cache directory private: %w", err)
+		}
+	} else if _, warned := warnedDirs.LoadOrStore(dir, true); !warned {
+		log.Printf("cache directory %s is accessible by other users, only the files in it are private", dir)
+	}
+
+	return dir, nil
+}
+
+// warnedDirs are the directories that were warned about, so the warning is logged once.
+var warnedDirs sync.Map
+
+// DefaultDir returns the directory systemd provides to the service in $CACHE_DIRECTORY or $STATE_DIRECTORY,
+// or cloudflare-ddns in the user's cache directory otherwise.
+func DefaultDir() (string, error) {
+	for _, env := range []string{"CACHE_DIRECTORY", "STATE_DIRECTORY"} {
+		// systemd separates the directories with colons if the unit configures several.
+		if dir := strings.Split(os.Getenv(env), ":")[0]; dir != "" {
+			return dir, nil
+		}
+	}
+
+	return userDir()
+}
+
+// userDir returns cloudflare-ddns in the user's cache directory.
+func userDir() (string, error) {
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
-		return "", fmt.Errorf("could not get home directory: %w", err)
+		return "", fmt.Errorf("could not get home directory, set -cache-dir instead: %w", err)
+	}
+
+	return path.Join(cacheDir, "cloudflare-ddns"), nil
+}
+
+// path returns the path of the file of the entry, named after its name and type.
+func (c *Cache) path(e Entry) (string, error) {
+	return c.filename(e.Name, string(e.Type), ".json")
+}
+
+func (c *Cache) filename(first, second, ext string) (string, error) {
+	dir, err := Dir(c.dir)
+	if err != nil {
+		return "", err
 	}
+	filename := fmt.Sprintf("%s-%s%s", sanitize(first), sanitize(second), ext)
+
+	return path.Join(dir, filename), nil
+}
 
-	dir := "cloudflare-ddns"
-	if err := os.MkdirAll(path.Join(cacheDir, dir), os.ModePerm); err != nil {
-		return "", fmt.Errorf("could not create config directory: %w", err)
+// sanitize escapes every character of the name that is not safe in filenames on every system, such as
+// the path separators or the asterisk of a wildcard record, as a percent sign and its hexadecimal code.
+func sanitize(name string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			_, _ = fmt.Fprintf(&b, "%%%02X", c)
+		}
 	}
-	filename := fmt.Sprintf("%s-%s.json", domain, recordType)
 
-	return path.Join(cacheDir, dir, filename), nil
+	return b.String()
 }
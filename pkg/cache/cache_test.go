@@ -3,20 +3,36 @@ package cache_test
 import (
 	"cloudflare-ddns/pkg/cache"
 	"cloudflare-ddns/pkg/cloudflare"
+	"errors"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	return dir
+}
+
 func TestCache_SaveAndGetRecord(t *testing.T) {
-	c := cache.Cache{}
-	want := cloudflare.Record{
+	dir := tempDir(t)
+	c := cache.New(dir)
+	want := cache.NewEntry(cloudflare.Record{
 		ID:      "f0764281-2853-4e5c-842d-bea41fcbccdf",
+		ZoneID:  "023e105f4ecef8ad9ca31a8372d0c353",
 		Type:    "A",
 		Name:    "test.nenad.dev",
 		Content: "192.168.0.1",
-	}
+	}, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
 
 	if err := c.SaveRecord(want); err != nil {
 		t.Fatalf("could not save record: %s", err)
@@ -31,9 +47,246 @@ func TestCache_SaveAndGetRecord(t *testing.T) {
 		t.Fatalf("records don't match. want %#v, got %#v", want, got)
 	}
 
-	cacheDir, _ := os.UserCacheDir()
+	if _, err := os.Stat(path.Join(dir, "test.nenad.dev-A.json")); err != nil {
+		t.Fatalf("expected the record in its file: %s", err)
+	}
+}
+
+func TestCache_DeleteRecord(t *testing.T) {
+	c := cache.New(tempDir(t))
+	if err := c.SaveRecord(cache.Entry{Type: "AAAA", Name: "deleted.nenad.dev", Content: "::1"}); err != nil {
+		t.Fatalf("could not save record: %s", err)
+	}
+
+	if err := c.DeleteRecord("deleted.nenad.dev", "AAAA"); err != nil {
+		t.Fatalf("could not delete record: %s", err)
+	}
+
+	if _, err := c.GetRecord("deleted.nenad.dev", "AAAA"); err == nil {
+		t.Errorf("expected the deleted record to be gone")
+	}
+
+	if err := c.DeleteRecord("deleted.nenad.dev", "AAAA"); err != nil {
+		t.Errorf("deleting a missing record should not fail: %s", err)
+	}
+}
+
+func TestCache_SaveRecordReplacesFile(t *testing.T) {
+	dir := tempDir(t)
+	c := cache.New(dir)
+	for _, content := range []string{"192.168.0.1", "192.168.0.2"} {
+		if err := c.SaveRecord(cache.Entry{Type: "A", Name: "replaced.nenad.dev", Content: content}); err != nil {
+			t.Fatalf("could not save record: %s", err)
+		}
+	}
+
+	if rec, err := c.GetRecord("replaced.nenad.dev", "A"); err != nil || rec.Content != "192.168.0.2" {
+		t.Fatalf("expected the last saved record, got %#v (%v)", rec, err)
+	}
+
+	if tmp, _ := filepath.Glob(path.Join(dir, "replaced.nenad.dev-A.json.*")); len(tmp) > 0 {
+		t.Errorf("expected no temporary files to be left, got %v", tmp)
+	}
+}
+
+func TestCache_Lock(t *testing.T) {
+	c := cache.New(tempDir(t))
+	unlock, err := c.Lock("locked.nenad.dev", "A")
+	if err != nil {
+		t.Fatalf("could not lock record: %s", err)
+	}
+
+	if _, err := c.Lock("locked.nenad.dev", "A"); !errors.Is(err, cache.ErrLocked) {
+		t.Fatalf("expected the record to be locked, got %v", err)
+	}
+
+	other, err := c.Lock("locked.nenad.dev", "AAAA")
+	if err != nil {
+		t.Fatalf("expected other records not to be locked, got %s", err)
+	}
+	_ = other()
+
+	if err := unlock(); err != nil {
+		t.Fatalf("could not unlock record: %s", err)
+	}
+
+	unlock, err = c.Lock("locked.nenad.dev", "A")
+	if err != nil {
+		t.Fatalf("expected the record to be unlocked, got %s", err)
+	}
+	_ = unlock()
+}
+
+func TestCache_Directory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := cache.New(path.Join(dir, "state"))
+	recs := []cache.Entry{
+		{Type: "A", Name: "*.nenad.dev", Content: "192.168.0.1"},
+		{Type: "A", Name: "../../escaped.nenad.dev", Content: "192.168.0.2"},
+		{Type: "A/../../AAAA", Name: "nenad.dev", Content: "192.168.0.3"},
+	}
+	for _, rec := range recs {
+		if err := c.SaveRecord(rec); err != nil {
+			t.Fatalf("could not save record: %s", err)
+		}
+
+		if got, err := c.GetRecord(rec.Name, string(rec.Type)); err != nil || got.Content != rec.Content {
+			t.Errorf("want record %#v, got %#v (%v)", rec, got, err)
+		}
+	}
+
+	if info, err := os.Stat(path.Join(dir, "state")); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the directory to be private, got %v (%v)", info.Mode(), err)
+	}
+
+	files, _ := ioutil.ReadDir(path.Join(dir, "state"))
+	if len(files) != len(recs) {
+		t.Fatalf("expected every record in its own file of the directory, got %d files", len(files))
+	}
+	for _, f := range files {
+		if f.Mode().Perm() != 0600 {
+			t.Errorf("expected %s to be private, got %v", f.Name(), f.Mode())
+		}
+	}
+
+	if others, _ := ioutil.ReadDir(dir); len(others) != 1 {
+		t.Errorf("expected no files outside of the directory, got %d entries", len(others))
+	}
+}
+
+func TestCache_KeepsOtherFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The cache directory can be shared with other state, such as in $STATE_DIRECTORY.
+	others := map[string]string{
+		"settings.json":          `{"foo":1}`,
+		"other.nenad.dev-A.json": `{"id":"372e6795","type":"A","name":"other.nenad.dev","content":"192.168.0.2"}`,
+		"home.nenad.dev-A.json":  `{"foo":1}`,
+	}
+	for name, data := range others {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatalf("could not write %s: %s", name, err)
+		}
+	}
+
+	c := cache.New(dir)
+	if _, err := c.GetRecord("home.nenad.dev", "A"); err == nil {
+		t.Errorf("expected an error for a file that does not hold the record")
+	}
+	if err := c.DeleteRecord("home.nenad.dev", "A"); err == nil {
+		t.Errorf("expected the file that does not hold the record to be kept")
+	}
+	if err := c.SaveRecord(cache.Entry{Type: "AAAA", Name: "home.nenad.dev", Content: "::1"}); err != nil {
+		t.Fatalf("could not save record: %s", err)
+	}
+	if err := c.DeleteRecord("home.nenad.dev", "AAAA"); err != nil {
+		t.Fatalf("could not delete record: %s", err)
+	}
+
+	for name, want := range others {
+		if data, err := ioutil.ReadFile(path.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("expected %s to be left as it was, got %q (%v)", name, data, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != len(others) {
+		t.Errorf("expected only the other files to be left, got %d files", len(files))
+	}
+}
+
+func TestCache_ExistingDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Existing directories keep their mode, while files written by earlier versions are made private.
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("could not change directory mode: %s", err)
+	}
+	legacy := `{"id":"372e6795","zone_id":"023e105f","type":"A","name":"home.nenad.dev","content":"192.168.0.1"}`
+	if err := ioutil.WriteFile(path.Join(dir, "home.nenad.dev-A.json"), []byte(legacy), 0644); err != nil {
+		t.Fatalf("could not write legacy file: %s", err)
+	}
+
+	if _, err := cache.New(dir).GetRecord("home.nenad.dev", "A"); err != nil {
+		t.Fatalf("could not get record: %s", err)
+	}
+
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("expected the directory to keep its mode, got %v (%v)", info.Mode(), err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("expected the legacy file to be migrated, got %d files", len(files))
+	}
+	if f := files[0]; f.Mode().Perm() != 0600 {
+		t.Errorf("expected the migrated %s to be private, got %v", f.Name(), f.Mode())
+	}
+}
+
+func TestDir_UserDirectory(t *testing.T) {
+	home := tempDir(t)
+	for _, env := range []string{"CACHE_DIRECTORY", "STATE_DIRECTORY", "XDG_CACHE_HOME", "HOME"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	_ = os.Setenv("CACHE_DIRECTORY", "")
+	_ = os.Setenv("STATE_DIRECTORY", "")
+	_ = os.Setenv("XDG_CACHE_HOME", path.Join(home, ".cache"))
+	_ = os.Setenv("HOME", home)
+
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		t.Skipf("no user cache directory: %s", err)
+	}
+
+	// Earlier versions created the directory in the user's cache directory readable by everyone.
+	if err := os.MkdirAll(path.Join(userCache, "cloudflare-ddns"), 0755); err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	dir, err := cache.Dir("")
+	if err != nil {
+		t.Fatalf("could not get cache directory: %s", err)
+	}
+	if info, err := os.Stat(dir); err != nil || dir != path.Join(userCache, "cloudflare-ddns") || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected %s to be made private, got %v (%v)", dir, info.Mode(), err)
+	}
+
+	// Other directories, such as a shared one given with -cache-dir, keep their mode.
+	shared := path.Join(home, "shared")
+	if err := os.Mkdir(shared, 0755); err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	if _, err := cache.Dir(shared); err != nil {
+		t.Fatalf("could not get cache directory: %s", err)
+	}
+	if info, err := os.Stat(shared); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("expected the given directory to keep its mode, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	for _, env := range []string{"CACHE_DIRECTORY", "STATE_DIRECTORY"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+
+	_ = os.Setenv("CACHE_DIRECTORY", "")
+	_ = os.Setenv("STATE_DIRECTORY", "/var/lib/cloudflare-ddns")
+	if dir, err := cache.DefaultDir(); err != nil || dir != "/var/lib/cloudflare-ddns" {
+		t.Errorf("expected the state directory, got %q (%v)", dir, err)
+	}
 
-	if err := os.Remove(path.Join(cacheDir, "cloudflare-ddns", "test.nenad.dev-A.json")); err != nil {
-		t.Fatalf("error while removing file: %s", err)
+	_ = os.Setenv("CACHE_DIRECTORY", "/var/cache/cloudflare-ddns:/var/cache/other")
+	if dir, err := cache.DefaultDir(); err != nil || dir != "/var/cache/cloudflare-ddns" {
+		t.Errorf("expected the first cache directory, got %q (%v)", dir, err)
 	}
 }
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version is the version of the cache schema written by this version of the application.
+// Entries without a version are the plain records cached by earlier versions, which are migrated when read.
+const Version = 1
+
+// Entry is the cached state of a managed record.
+type Entry struct {
+	Version  int             `json:"version"`
+	ZoneID   string          `json:"zone_id"`
+	RecordID string          `json:"record_id"`
+	Name     string          `json:"name"`
+	Type     cloudflare.Type `json:"type"`
+	Content  string          `json:"content"`            // Content is the last published content.
+	TTL      int             `json:"ttl"`                // TTL is the last published TTL.
+	Proxied  bool            `json:"proxied"`            // Proxied is the last published proxying.
+	Verified time.Time       `json:"verified,omitempty"` // Verified is when the record was last read or updated, zero if unknown.
+	Error    string          `json:"error,omitempty"`    // Error of the last update, empty if it succeeded.
+}
+
+// NewEntry returns the entry of the record, verified at the time.
+func NewEntry(rec cloudflare.Record, verified time.Time) Entry {
+	return Entry{
+		Version:  Version,
+		ZoneID:   rec.ZoneID,
+		RecordID: rec.ID,
+		Name:     rec.Name,
+		Type:     rec.Type,
+		Content:  rec.Content,
+		TTL:      rec.TTL,
+		Proxied:  rec.Proxied,
+		Verified: verified,
+	}
+}
+
+// Key identifies the record of the entry by its name and type, the key of the entry in the backends.
+func (e Entry) Key() string {
+	return entryKey(e.Name, string(e.Type))
+}
+
+// entryKey returns the key of the entry of the record with the name and type.
+func entryKey(domain, recordType string) string {
+	return domain + "/" + recordType
+}
+
+// Matches reports whether the entry is of the record with the name and type.
+func (e Entry) Matches(domain, recordType string) bool {
+	return e.Name == domain && string(e.Type) == recordType
+}
+
+// Record returns the record as it was last published.
+func (e Entry) Record() cloudflare.Record {
+	return cloudflare.Record{
+		ID:      e.RecordID,
+		ZoneID:  e.ZoneID,
+		Name:    e.Name,
+		Type:    e.Type,
+		Content: e.Content,
+		TTL:     e.TTL,
+		Proxied: e.Proxied,
+	}
+}
+
+// decodeEntry decodes an entry of any version, migrating older ones to the current version.
+// It reports whether the entry was migrated, so it can be saved again. Data without a version is
+// only taken for a record cached by an earlier version if it has the name and type of a record.
+func decodeEntry(data []byte) (Entry, bool, error) {
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, false, fmt.Errorf("could not unmarshal cached record: %w", err)
+	}
+
+	switch {
+	case e.Version == Version:
+		return e, false, nil
+	case e.Version > Version:
+		return e, false, fmt.Errorf("cached record has version %d, which is newer than this version of the application", e.Version)
+	}
+
+	var rec cloudflare.Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return e, false, fmt.Errorf("could not unmarshal cached record: %w", err)
+	}
+	if rec.Name == "" || rec.Type == "" {
+		return e, false, errors.New("not a cached record, it has no version, name or type")
+	}
+
+	return NewEntry(rec, time.Time{}), true, nil
+}
+
+// decodeStored decodes the entry of the record stored under its key in a backend, nil if there is none.
+func decodeStored(data []byte, domain, recordType string) (Entry, error) {
+	if data == nil {
+		return Entry{}, fmt.Errorf("no cached %s record of %q", recordType, domain)
+	}
+
+	e, _, err := decodeEntry(data)
+	return e, err
+}
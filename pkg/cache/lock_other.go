@@ -0,0 +1,20 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cache
+
+import "os"
+
+// Records are not locked on systems without flock, where concurrent updates are not prevented,
+// and directories cannot be synced.
+func lock(*os.File) error {
+	return nil
+}
+
+func unlock(*os.File) error {
+	return nil
+}
+
+func syncDir(string) error {
+	return nil
+}
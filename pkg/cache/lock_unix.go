@@ -0,0 +1,39 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func lock(f *os.File) error {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	} else if err != nil {
+		return fmt.Errorf("could not lock record: %w", err)
+	}
+
+	return nil
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// syncDir flushes the directory, so a renamed file survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not open cache directory: %w", err)
+	}
+
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return fmt.Errorf("could not sync cache directory: %w", err)
+	}
+
+	return d.Close()
+}
@@ -1,14 +1,10 @@
 package cache
 
-import (
-	"cloudflare-ddns/pkg/cloudflare"
-)
-
 type NoopCache struct{}
 
-func (c *NoopCache) GetRecord(domain, recordType string) (cloudflare.Record, error) {
-	return cloudflare.Record{}, nil
+func (c *NoopCache) GetRecord(domain, recordType string) (Entry, error) {
+	return Entry{}, nil
 }
-func (c *NoopCache) SaveRecord(record cloudflare.Record) error {
+func (c *NoopCache) SaveRecord(e Entry) error {
 	return nil
 }
@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRedisPrefix starts the keys of the records in Redis.
+	DefaultRedisPrefix = "cloudflare-ddns:"
+
+	// recordsHash is the hash holding the entries of every record, by their name and type, after the prefix.
+	recordsHash = "records"
+
+	// DefaultRedisLockTTL expires locks of processes that died while updating a record.
+	DefaultRedisLockTTL = time.Minute
+
+	// unlockScript deletes the lock in KEYS[1] only if it still holds the token in ARGV[1], in a single step,
+	// so a lock taken over by another instance after expiring is never deleted.
+	unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+	// refreshScript sets the lock in KEYS[1] to expire after ARGV[2] milliseconds only if it still holds the token in ARGV[1].
+	refreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+type (
+	// RedisCache keeps the records in Redis, or any server speaking its protocol, so they are shared by
+	// every instance. Records are stored as JSON in a hash under the prefix, by their name and type.
+	RedisCache struct {
+		addr     string
+		password string
+		db       int
+		prefix   string
+		timeout  time.Duration
+		lockTTL  time.Duration
+	}
+
+	// RedisError is an error reply of the Redis server.
+	RedisError struct {
+		Message string
+	}
+
+	// redisConn is a connection sending commands in the Redis serialization protocol (RESP).
+	redisConn struct {
+		conn net.Conn
+		r    *bufio.Reader
+	}
+)
+
+// RedisPassword sets the password authenticating to the server.
+func RedisPassword(password string) func(*RedisCache) {
+	return func(c *RedisCache) {
+		c.password = password
+	}
+}
+
+// RedisDB selects the database of the server.
+func RedisDB(db int) func(*RedisCache) {
+	return func(c *RedisCache) {
+		c.db = db
+	}
+}
+
+// RedisPrefix sets the prefix of the keys of the records.
+func RedisPrefix(prefix string) func(*RedisCache) {
+	return func(c *RedisCache) {
+		c.prefix = prefix
+	}
+}
+
+// RedisLockTTL sets how long the lock of an instance that stopped without unlocking a record is kept.
+func RedisLockTTL(ttl time.Duration) func(*RedisCache) {
+	return func(c *RedisCache) {
+		c.lockTTL = ttl
+	}
+}
+
+// NewRedis returns a cache keeping records in the Redis server at the address, as host:port.
+func NewRedis(addr string, options ...func(*RedisCache)) *RedisCache {
+	c := &RedisCache{addr: addr, prefix: DefaultRedisPrefix, timeout: 10 * time.Second, lockTTL: DefaultRedisLockTTL}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// GetRecord returns the entry of the record.
+func (c *RedisCache) GetRecord(domain, recordType string) (e Entry, err error) {
+	reply, err := c.do("HGET", c.prefix+recordsHash, entryKey(domain, recordType))
+	if err != nil {
+		return e, fmt.Errorf("could not get cached record: %w", err)
+	}
+
+	var data []byte
+	if value, ok := reply.(string); ok {
+		data = []byte(value)
+	}
+
+	return decodeStored(data, domain, recordType)
+}
+
+func (c *RedisCache) SaveRecord(e Entry) error {
+	e.Version = Version
+	value, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not marshal record: %w", err)
+	}
+
+	if _, err := c.do("HSET", c.prefix+recordsHash, e.Key(), string(value)); err != nil {
+		return fmt.Errorf("could not save cached record: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRecord removes the cached entry of the record, it is not an error if there is none.
+func (c *RedisCache) DeleteRecord(domain, recordType string) error {
+	if _, err := c.do("HDEL", c.prefix+recordsHash, entryKey(domain, recordType)); err != nil {
+		return fmt.Errorf("could not delete cached record: %w", err)
+	}
+
+	return nil
+}
+
+// Lock locks the record against updates by every instance sharing the server, until the returned
+// function unlocks it. The lock is refreshed while it is held, however long the update takes, and the
+// locks of instances that stopped without unlocking them expire after the lock TTL, a minute by default.
+// It does not wait for the lock, returning ErrLocked if the record is already locked.
+func (c *RedisCache) Lock(domain, recordType string) (func() error, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("could not generate lock token: %w", err)
+	}
+
+	lockKey, token, ttl := c.key(domain, recordType)+":lock", hex.EncodeToString(b), strconv.FormatInt(c.lockTTL.Milliseconds(), 10)
+	reply, err := c.do("SET", lockKey, token, "NX", "PX", ttl)
+	if err != nil {
+		return nil, fmt.Errorf("could not lock record: %w", err)
+	}
+	if reply == nil {
+		return nil, ErrLocked
+	}
+
+	stop, stopped := make(chan struct{}), make(chan error, 1)
+	go func() { stopped <- c.refresh(lockKey, token, ttl, stop) }()
+
+	return func() error {
+		close(stop)
+		lost := <-stopped
+		if _, err := c.do("EVAL", unlockScript, "1", lockKey, token); err != nil {
+			return fmt.Errorf("could not unlock record: %w", err)
+		}
+		return lost
+	}, nil
+}
+
+// refresh extends the lock three times in its lifetime until stopped. Failed attempts are repeated on the
+// next tick, while the lock still lives, and an error is returned if the lock expired in the meantime.
+func (c *RedisCache) refresh(lockKey, token, ttl string, stop <-chan struct{}) error {
+	ticker := time.NewTicker(c.lockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		if reply, err := c.do("EVAL", refreshScript, "1", lockKey, token, ttl); err == nil && reply == int64(0) {
+			return fmt.Errorf("lock of record expired while updating it")
+		}
+	}
+}
+
+// key returns the key of the record, under which its lock is kept.
+func (c *RedisCache) key(domain, recordType string) string {
+	return c.prefix + domain + "/" + recordType
+}
+
+// do sends the command on a new connection and returns its reply, nil if the reply is a null bulk string.
+func (c *RedisCache) do(args ...string) (reply interface{}, err error) {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := conn.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if c.password != "" {
+		if _, err := rc.do("AUTH", c.password); err != nil {
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			return nil, err
+		}
+	}
+
+	return rc.do(args...)
+}
+
+// do writes the command as an array of bulk strings and reads its reply.
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	b := &strings.Builder{}
+	_, _ = fmt.Fprintf(b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		_, _ = fmt.Fprintf(b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := io.WriteString(rc.conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	return rc.read()
+}
+
+// read reads a reply, returning simple and bulk strings as strings, integers as int64 and arrays as []interface{}.
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &RedisError{Message: line[1:]}
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		elems := make([]interface{}, n)
+		for i := range elems {
+			if elems[i], err = rc.read(); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
+
+func (e *RedisError) Error() string {
+	return fmt.Sprintf("redis: %s", e.Message)
+}
@@ -0,0 +1,87 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Authenticator adds CloudFlare credentials to an API request made for the given zone.
+	Authenticator interface {
+		Authenticate(req *http.Request, zone string) error
+	}
+
+	// BearerToken authenticates with an API token.
+	BearerToken string
+
+	// GlobalKey authenticates with the legacy Global API Key of the account with the given email.
+	GlobalKey struct {
+		Email string
+		Key   string
+	}
+
+	// ZoneTokens authenticates with an API token per zone name, falling back to the Default token
+	// for zones without their own token.
+	ZoneTokens struct {
+		Tokens  map[string]string
+		Default string
+	}
+
+	zoneKey struct{}
+)
+
+// Authenticate sets the bearer token in the Authorization header.
+func (t BearerToken) Authenticate(req *http.Request, _ string) error {
+	if t == "" {
+		return fmt.Errorf("token is empty")
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t))
+	return nil
+}
+
+// Authenticate sets the email and the key in the X-Auth-Email and X-Auth-Key headers.
+func (k GlobalKey) Authenticate(req *http.Request, _ string) error {
+	if k.Email == "" || k.Key == "" {
+		return fmt.Errorf("email and global API key must not be empty")
+	}
+
+	req.Header.Set("X-Auth-Email", k.Email)
+	req.Header.Set("X-Auth-Key", k.Key)
+	return nil
+}
+
+// Authenticate sets the bearer token of the zone in the Authorization header.
+func (z ZoneTokens) Authenticate(req *http.Request, zone string) error {
+	token, ok := z.Tokens[zone]
+	if !ok {
+		token = z.Default
+	}
+
+	if token == "" {
+		return fmt.Errorf("no token configured for zone %q", zone)
+	}
+
+	return BearerToken(token).Authenticate(req, zone)
+}
+
+// ZoneName returns the name of the zone the domain belongs to.
+func ZoneName(domain string) string {
+	parts := strings.Split(domain, ".")
+	if len(parts) < 2 {
+		return domain
+	}
+
+	return strings.Join(parts[len(parts)-2:], ".")
+}
+
+func withZone(ctx context.Context, domain string) context.Context {
+	return context.WithValue(ctx, zoneKey{}, ZoneName(domain))
+}
+
+func zoneFromContext(ctx context.Context) string {
+	zone, _ := ctx.Value(zoneKey{}).(string)
+	return zone
+}
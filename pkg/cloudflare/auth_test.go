@@ -0,0 +1,87 @@
+package cloudflare_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticators(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    cloudflare.Authenticator
+		zone    string
+		want    http.Header
+		wantErr bool
+	}{
+		{
+			name: "bearer token sets the authorization header",
+			auth: cloudflare.BearerToken("token"),
+			zone: "nenad.dev",
+			want: http.Header{"Authorization": {"Bearer token"}},
+		},
+		{
+			name:    "empty bearer token fails",
+			auth:    cloudflare.BearerToken(""),
+			zone:    "nenad.dev",
+			wantErr: true,
+		},
+		{
+			name: "global key sets the email and key headers",
+			auth: cloudflare.GlobalKey{Email: "me@nenad.dev", Key: "key"},
+			zone: "nenad.dev",
+			want: http.Header{"X-Auth-Email": {"me@nenad.dev"}, "X-Auth-Key": {"key"}},
+		},
+		{
+			name:    "global key without email fails",
+			auth:    cloudflare.GlobalKey{Key: "key"},
+			zone:    "nenad.dev",
+			wantErr: true,
+		},
+		{
+			name: "zone tokens use the token of the zone",
+			auth: cloudflare.ZoneTokens{Tokens: map[string]string{"nenad.dev": "zone-token"}, Default: "token"},
+			zone: "nenad.dev",
+			want: http.Header{"Authorization": {"Bearer zone-token"}},
+		},
+		{
+			name: "zone tokens fall back to the default token",
+			auth: cloudflare.ZoneTokens{Tokens: map[string]string{"nenad.dev": "zone-token"}, Default: "token"},
+			zone: "hello.dev",
+			want: http.Header{"Authorization": {"Bearer token"}},
+		},
+		{
+			name:    "zone tokens without a matching or default token fail",
+			auth:    cloudflare.ZoneTokens{Tokens: map[string]string{"nenad.dev": "zone-token"}},
+			zone:    "hello.dev",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "https://api.cloudflare.com/client/v4/zones", nil)
+			err := tt.auth.Authenticate(req, tt.zone)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("did not expect an error: %s", err)
+			}
+			if !reflect.DeepEqual(tt.want, req.Header) {
+				t.Fatalf("headers mismatch; want %v, got %v", tt.want, req.Header)
+			}
+		})
+	}
+}
+
+func TestNewClientRequiresAuthentication(t *testing.T) {
+	if _, err := cloudflare.NewClient(); err == nil {
+		t.Fatalf("expected an error when no authentication is configured")
+	}
+}
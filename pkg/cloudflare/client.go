@@ -8,20 +8,25 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"reflect"
+	"net/url"
 	"strings"
 	"time"
 )
 
 const (
-	baseAPI = "https://api.cloudflare.com/client/v4"
-	perPage = 50
+	// DefaultBaseURL is the URL of CloudFlare's API.
+	DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+	perPage        = 50
+
+	// maxResponseSize limits how much of a response body is read.
+	maxResponseSize = 1 << 20
 )
 
 // API is an HTTP client that can invoke CloudFlare's API functions.
 type API struct {
-	client *http.Client
-	token  string
+	client  *http.Client
+	auth    Authenticator
+	baseURL string
 }
 
 // Retry sets the attempt number when making API calls to CloudFlare.
@@ -35,6 +40,26 @@ func Retry(attempts int) func(*API) {
 	}
 }
 
+// Token sets the API token used for authenticating to CloudFlare.
+func Token(token string) func(*API) {
+	return Authentication(BearerToken(token))
+}
+
+// Authentication sets the strategy used for authenticating to CloudFlare, such as a
+// BearerToken, a GlobalKey or ZoneTokens.
+func Authentication(auth Authenticator) func(*API) {
+	return func(a *API) {
+		a.auth = auth
+	}
+}
+
+// BaseURL sets the URL of CloudFlare's API, such as a path behind a proxy or a local mock.
+func BaseURL(url string) func(*API) {
+	return func(a *API) {
+		a.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
 // Client sets the HTTP client used for making requests to CloudFlare.
 func Client(client *http.Client) func(*API) {
 	return func(a *API) {
@@ -49,95 +74,168 @@ func Timeout(duration time.Duration) func(*API) {
 	}
 }
 
-// NewClient returns an HTTP client that can invoke CloudFlare's API
-func NewClient(token string, options ...func(*API)) (*API, error) {
-	if token == "" {
-		return nil, fmt.Errorf("token is empty")
-	}
-
+// NewClient returns an HTTP client that can invoke CloudFlare's API.
+// Either the Token or the Authentication option must be provided.
+func NewClient(options ...func(*API)) (*API, error) {
 	a := &API{
 		client: &http.Client{
 			Timeout:   time.Second * 10,
 			Transport: http.DefaultTransport,
 		},
-		token: token,
+		baseURL: DefaultBaseURL,
 	}
 	for _, o := range options {
 		o(a)
 	}
 
+	if a.auth == nil {
+		return nil, fmt.Errorf("no authentication configured")
+	}
+
 	return a, nil
 }
 
 // GetRecord will return the DNS record matching the given record and type.
 // Returns an error if there are either no records or duplicate records found.
 func (a *API) GetRecord(ctx context.Context, name string, recordType Type) (rec Record, err error) {
-	page := 1
+	recs, err := a.GetRecords(ctx, name, recordType)
+	if err != nil {
+		return rec, err
+	}
+
+	switch len(recs) {
+	case 0:
+		return rec, fmt.Errorf("no record for %q of type %s found", name, recordType)
+	case 1:
+		return recs[0], nil
+	default:
+		return rec, fmt.Errorf("found duplicate entry for %q and type %q", name, recordType)
+	}
+}
+
+// GetRecords will return all DNS records matching the given name and type, such as the members of a round-robin set.
+// Returns an empty list if there are no matching records.
+func (a *API) GetRecords(ctx context.Context, name string, recordType Type) ([]Record, error) {
+	ctx = withZone(ctx, name)
 	zone, err := a.getZone(ctx, name)
 	if err != nil {
-		return rec, fmt.Errorf("error getting zone information: %w", err)
+		return nil, fmt.Errorf("error getting zone information: %w", err)
+	}
+
+	return a.records(ctx, zone, RecordFilter{Name: name, Type: recordType})
+}
+
+// ListRecords will return all DNS records of the zone matching the filter, following every page of the listing.
+func (a *API) ListRecords(ctx context.Context, zone string, filter RecordFilter) ([]Record, error) {
+	ctx = withZone(ctx, zone)
+	zoneID, err := a.getZone(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error getting zone information: %w", err)
+	}
+
+	return a.records(ctx, zoneID, filter)
+}
+
+// records pages through the records of the zone with the given ID, filtered by CloudFlare.
+func (a *API) records(ctx context.Context, zone string, filter RecordFilter) ([]Record, error) {
+	query := ""
+	if filter.Name != "" {
+		query += fmt.Sprintf("name=%s&", url.QueryEscape(filter.Name))
+	}
+	if filter.Type != "" {
+		query += fmt.Sprintf("type=%s&", filter.Type)
 	}
 
+	page := 1
+	var recs []Record
 	for {
 		dnsResp := DNSResponse{}
-		err := a.send(ctx, "GET", api("/zones/%s/dns_records?page=%d&per_page=%d", zone, page, perPage), nil, &dnsResp)
+		err := a.send(ctx, "GET", a.api("/zones/%s/dns_records?%spage=%d&per_page=%d", zone, query, page, perPage), nil, &dnsResp)
 		if err != nil {
-			return rec, err
+			return nil, err
 		}
 
+		// CloudFlare filters by name and type already, this guards against receiving unrelated records.
 		for _, r := range *dnsResp.Result {
-			if r.Name == name && r.Type == recordType {
-				if rec != (Record{}) {
-					return Record{}, fmt.Errorf("found duplicate entry for %q and type %q", r.Name, r.Type)
-				}
-
-				rec = r
+			if filter.Matches(r) {
+				recs = append(recs, r)
 			}
 		}
 
 		if page >= dnsResp.ResultInfo.TotalPages {
-			if rec == (Record{}) {
-				return rec, fmt.Errorf("no record for %q of type %s found", name, recordType)
-			}
-
-			return rec, err
+			return recs, nil
 		}
 		page++
 	}
 }
 
-// UpdateRecord will update the record with the given value.
+// CreateRecord will create a new DNS record from the request and return it.
 // Returns an error if there are any CloudFlare errors returned.
-func (a *API) UpdateRecord(ctx context.Context, id string, request DNSUpdateRequest) error {
-	if request.TTL == 0 {
-		request.TTL = 1
-	}
-
+func (a *API) CreateRecord(ctx context.Context, request DNSUpdateRequest) (Record, error) {
+	ctx = withZone(ctx, request.Name)
 	zone, err := a.getZone(ctx, request.Name)
 	if err != nil {
-		return fmt.Errorf("error getting zone information: %w", err)
+		return Record{}, fmt.Errorf("error getting zone information: %w", err)
+	}
+
+	resp := DNSRecordResponse{}
+	if err := a.send(ctx, "POST", a.api("/zones/%s/dns_records", zone), &request, &resp); err != nil {
+		return Record{}, err
 	}
 
-	return a.send(ctx, "PUT", api("/zones/%s/dns_records/%s", zone, id), &request, &Response{})
+	return resp.Result, nil
+}
+
+// UpdateRecord will apply the changes in the request to the given record.
+// Fields missing from the request are left untouched.
+// Returns an error if there are any CloudFlare errors returned.
+func (a *API) UpdateRecord(ctx context.Context, rec Record, request DNSUpdateRequest) error {
+	ctx = withZone(ctx, rec.Name)
+	zone := rec.ZoneID
+	if zone == "" {
+		var err error
+		if zone, err = a.getZone(ctx, rec.Name); err != nil {
+			return fmt.Errorf("error getting zone information: %w", err)
+		}
+	}
+
+	return a.send(ctx, "PATCH", a.api("/zones/%s/dns_records/%s", zone, rec.ID), &request, &Response{})
+}
+
+// DeleteRecord deletes the given record.
+// Returns an error if there are any CloudFlare errors returned.
+func (a *API) DeleteRecord(ctx context.Context, rec Record) error {
+	ctx = withZone(ctx, rec.Name)
+	zone := rec.ZoneID
+	if zone == "" {
+		var err error
+		if zone, err = a.getZone(ctx, rec.Name); err != nil {
+			return fmt.Errorf("error getting zone information: %w", err)
+		}
+	}
+
+	return a.send(ctx, "DELETE", a.api("/zones/%s/dns_records/%s", zone, rec.ID), nil, &Response{})
 }
 
 func (a *API) getZone(ctx context.Context, domain string) (string, error) {
-	resp := &DNSResponse{}
-	parts := strings.Split(domain, ".")
-	zoneDomain := strings.Join(parts[len(parts)-2:], ".")
-	err := a.send(ctx, "GET", api("/zones?name=%s", zoneDomain), nil, resp)
+	zone, err := a.zoneDetails(ctx, domain)
+	return zone.ID, err
+}
+
+func (a *API) zoneDetails(ctx context.Context, domain string) (Zone, error) {
+	resp := &ZoneResponse{}
+	err := a.send(ctx, "GET", a.api("/zones?name=%s", ZoneName(domain)), nil, resp)
 	if err != nil {
-		return "", fmt.Errorf("could not get zone list: %w", err)
+		return Zone{}, fmt.Errorf("could not get zone list: %w", err)
 	}
 
-	if len(*resp.Result) > 0 {
-		rec := *resp.Result
-		return rec[0].ID, nil
+	if len(resp.Result) > 0 {
+		return resp.Result[0], nil
 	}
-	return "", fmt.Errorf("could not find zone that matches domain %q", domain)
+	return Zone{}, fmt.Errorf("could not find zone that matches domain %q", domain)
 }
 
-func (a *API) send(ctx context.Context, method, url string, send, recv interface{}) error {
+func (a *API) send(ctx context.Context, method, url string, send interface{}, recv responder) (err error) {
 	buf := &bytes.Buffer{}
 	if send != nil {
 		if err := json.NewEncoder(buf).Encode(send); err != nil {
@@ -154,13 +252,37 @@ func (a *API) send(ctx context.Context, method, url string, send, recv interface
 	if err != nil {
 		return fmt.Errorf("could not get response: %w", err)
 	}
+	defer func() {
+		cErr := resp.Body.Close()
+		if err == nil {
+			err = cErr
+		}
+	}()
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Path:       req.URL.Path,
+		RayID:      resp.Header.Get("CF-Ray"),
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&recv); err != nil {
-		return fmt.Errorf("could not decode response: %w", err)
+	// Errors from CloudFlare's edge, such as a 502, come as HTML pages instead of API responses.
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+		apiErr.Message = fmt.Sprintf("unexpected %q response", ct)
+		return apiErr
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(recv); err != nil {
+		if resp.StatusCode >= 400 {
+			apiErr.Message = fmt.Sprintf("could not decode response: %s", err)
+			return apiErr
+		}
+		return fmt.Errorf("could not decode response (CF-Ray %q): %w", apiErr.RayID, err)
 	}
 
-	if err := checkError(recv); err != nil {
-		return fmt.Errorf("error from CloudFlare: %w", err)
+	if r := recv.response(); !r.Success || resp.StatusCode >= 400 {
+		apiErr.Errors = r.Errors
+		return apiErr
 	}
 
 	return nil
@@ -172,51 +294,14 @@ func (a *API) request(ctx context.Context, method, url string, body io.Reader) (
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", a.token))
+	if err := a.auth.Authenticate(req, zoneFromContext(ctx)); err != nil {
+		return nil, fmt.Errorf("could not authenticate: %w", err)
+	}
+
 	req.Header.Add("Content-Type", "application/json")
 	return req, err
 }
 
-func api(format string, args ...interface{}) string {
-	return fmt.Sprintf("%s%s", baseAPI, fmt.Sprintf(format, args...))
-}
-
-func checkError(resp interface{}) error {
-	v := reflect.ValueOf(resp)
-	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
-		v = v.Elem()
-	}
-
-	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("received non-struct item: %s", v.Kind())
-	}
-
-	// If we received Success, no need to check for further errors
-	successField := v.FieldByName("Success").Interface()
-	if val, ok := successField.(bool); ok {
-		if val {
-			return nil
-		}
-	}
-
-	field := v.FieldByName("Errors").Interface()
-
-	errs, ok := field.([]Error)
-	if !ok {
-		return fmt.Errorf("field Errors is not of type []Error")
-	}
-
-	if len(errs) == 0 {
-		return nil
-	}
-
-	var err string
-	for _, e := range errs {
-		err = fmt.Sprintf("%s: [%d] %s", err, e.Code, e.Message)
-		for _, er := range e.ErrorChain {
-			err = fmt.Sprintf("%s: [%d] %s", err, e.Code, er.Message)
-		}
-	}
-
-	return fmt.Errorf("error in the response%s", err)
+func (a *API) api(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s%s", a.baseURL, fmt.Sprintf(format, args...))
 }
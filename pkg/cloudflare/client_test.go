@@ -4,12 +4,23 @@ import (
 	"cloudflare-ddns/pkg/cloudflare"
 	"cloudflare-ddns/pkg/test"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+)
+
+var (
+	fixtureTime = time.Date(2020, time.March, 29, 14, 32, 6, 559402000, time.UTC)
+	fixtureMeta = map[string]interface{}{
+		"auto_added":             false,
+		"managed_by_apps":        false,
+		"managed_by_argo_tunnel": false,
+	}
 )
 
 func jsonFixture(t *testing.T, file string) (body *test.Body) {
@@ -36,12 +47,22 @@ func Test_ClientGetRecord(t *testing.T) {
 		{
 			name:    "test single page get domain record",
 			fixture: "testdata/single_page.json",
-			wantURL: "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?page=1&per_page=50",
+			wantURL: "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?name=nenad.dev&type=A&page=1&per_page=50",
 			want: cloudflare.Record{
-				ID:      "a3bfb90b2b9d",
-				Type:    "A",
-				Name:    "nenad.dev",
-				Content: "192.168.0.2",
+				ID:         "a3bfb90b2b9d",
+				ZoneID:     "0c374e0067f0c409",
+				ZoneName:   "nenad.dev",
+				Type:       "A",
+				Name:       "nenad.dev",
+				Content:    "192.168.0.2",
+				Proxiable:  true,
+				Proxied:    true,
+				TTL:        1,
+				Comment:    "managed by cloudflare-ddns, updated 2020-03-29T14:32Z from host router",
+				Tags:       []string{"cloudflare-ddns:router"},
+				Meta:       fixtureMeta,
+				CreatedOn:  fixtureTime,
+				ModifiedOn: fixtureTime,
 			},
 			recName:  "nenad.dev",
 			recType:  cloudflare.A,
@@ -50,12 +71,20 @@ func Test_ClientGetRecord(t *testing.T) {
 		{
 			name:    "test single page get subdomain record",
 			fixture: "testdata/single_page.json",
-			wantURL: "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?page=1&per_page=50",
+			wantURL: "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?name=home.nenad.dev&type=AAAA&page=1&per_page=50",
 			want: cloudflare.Record{
-				ID:      "6e04a018b79b9302244a56d",
-				Type:    "AAAA",
-				Name:    "home.nenad.dev",
-				Content: "2a03:8103:98c1:7b0b:188c:243f:c6fc:86d2",
+				ID:         "6e04a018b79b9302244a56d",
+				ZoneID:     "0c374e0067f0c409",
+				ZoneName:   "nenad.dev",
+				Type:       "AAAA",
+				Name:       "home.nenad.dev",
+				Content:    "2a03:8103:98c1:7b0b:188c:243f:c6fc:86d2",
+				Proxiable:  true,
+				Proxied:    true,
+				TTL:        1,
+				Meta:       fixtureMeta,
+				CreatedOn:  fixtureTime,
+				ModifiedOn: fixtureTime,
 			},
 			recName:  "home.nenad.dev",
 			recType:  cloudflare.AAAA,
@@ -64,7 +93,7 @@ func Test_ClientGetRecord(t *testing.T) {
 		{
 			name:     "duplicate record will return error",
 			fixture:  "testdata/duplicate_entry.json",
-			wantURL:  "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?page=1&per_page=50",
+			wantURL:  "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?name=home.nenad.dev&type=A&page=1&per_page=50",
 			want:     cloudflare.Record{},
 			recName:  "home.nenad.dev",
 			recType:  cloudflare.A,
@@ -74,7 +103,7 @@ func Test_ClientGetRecord(t *testing.T) {
 		{
 			name:     "single page no record found should return error",
 			fixture:  "testdata/single_page.json",
-			wantURL:  "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?page=1&per_page=50",
+			wantURL:  "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records?name=not-found.hello.dev&type=A&page=1&per_page=50",
 			want:     cloudflare.Record{},
 			recName:  "not-found.hello.dev",
 			recType:  cloudflare.A,
@@ -87,7 +116,7 @@ func Test_ClientGetRecord(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			client, _ := cloudflare.NewClient("token", cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+			client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
 				if r.URL.String() == fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", tt.zoneName) {
 					return &http.Response{
 						StatusCode: 200,
@@ -129,5 +158,227 @@ func Test_ClientGetRecord(t *testing.T) {
 			}
 		})
 	}
+}
+
+func Test_ClientUpdateRecord(t *testing.T) {
+	rec := cloudflare.Record{
+		ID:      "a3bfb90b2b9d",
+		ZoneID:  "zone12345",
+		Type:    cloudflare.A,
+		Name:    "nenad.dev",
+		Content: "192.168.0.2",
+		Proxied: true,
+		TTL:     1,
+		Comment: "hand-written comment",
+		Tags:    []string{"env:prod"},
+	}
+	desired := rec
+	desired.Content = "192.168.0.3"
+
+	client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+		wantURL := "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records/a3bfb90b2b9d"
+		if r.Method != "PATCH" || r.URL.String() != wantURL {
+			t.Errorf("request mismatch, want PATCH %q, got %s %q", wantURL, r.Method, r.URL.String())
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if want := `{"content":"192.168.0.3"}`; strings.TrimSpace(string(body)) != want {
+			t.Errorf("body mismatch, want %s, got %s", want, body)
+		}
+
+		return &http.Response{
+			StatusCode: 200,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body: test.FromBytes([]byte(`{"success":true,"errors":[],"messages":[]}`)),
+		}
+	})))
+
+	if err := client.UpdateRecord(context.Background(), rec, cloudflare.Diff(rec, desired)); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+}
+
+func Test_ClientGetRecordsReturnsRecordSet(t *testing.T) {
+	client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+		fixture := "testdata/duplicate_entry.json"
+		if r.URL.String() == "https://api.cloudflare.com/client/v4/zones?name=nenad.dev" {
+			fixture = "testdata/zone.json"
+		}
+
+		return &http.Response{
+			StatusCode: 200,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body: jsonFixture(t, fixture),
+		}
+	})))
+
+	recs, err := client.GetRecords(context.Background(), "home.nenad.dev", cloudflare.A)
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	if len(recs) != 2 || recs[0].Content != "192.168.0.2" || recs[1].Content != "192.168.0.1" {
+		t.Fatalf("expected both records of the set, got %#v", recs)
+	}
+}
+
+func Test_ClientCreateRecord(t *testing.T) {
+	client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+		body := `{"result":{"id":"f0764281","type":"A","name":"home.nenad.dev","content":"192.168.0.3"},"success":true,"errors":[],"messages":[]}`
+		if r.URL.String() == "https://api.cloudflare.com/client/v4/zones?name=nenad.dev" {
+			return &http.Response{StatusCode: 200, Body: jsonFixture(t, "testdata/zone.json")}
+		}
+
+		wantURL := "https://api.cloudflare.com/client/v4/zones/zone12345/dns_records"
+		if r.Method != "POST" || r.URL.String() != wantURL {
+			t.Errorf("request mismatch, want POST %q, got %s %q", wantURL, r.Method, r.URL.String())
+		}
+
+		return &http.Response{StatusCode: 200, Body: test.FromBytes([]byte(body))}
+	})))
+
+	rec, err := client.CreateRecord(context.Background(), cloudflare.DNSUpdateRequest{
+		Name:    "home.nenad.dev",
+		Type:    cloudflare.A,
+		Content: "192.168.0.3",
+	})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	if rec.ID != "f0764281" || rec.Content != "192.168.0.3" {
+		t.Fatalf("unexpected created record %#v", rec)
+	}
+}
+
+// zoneTransport serves a zone of the given size in the style of the testdata fixtures,
+// optionally ignoring the name and type filters like the whole zone was listed.
+func zoneTransport(size int, filter bool, requests *int) test.Transport {
+	recs := make([]cloudflare.Record, 0, size)
+	for i := 0; i < size-1; i++ {
+		recs = append(recs, cloudflare.Record{
+			ID:      fmt.Sprintf("record%d", i),
+			Type:    cloudflare.A,
+			Name:    fmt.Sprintf("host%d.nenad.dev", i),
+			Content: "192.168.0.1",
+		})
+	}
+	recs = append(recs, cloudflare.Record{ID: "home", Type: cloudflare.A, Name: "home.nenad.dev", Content: "192.168.0.2"})
+
+	return func(r *http.Request) *http.Response {
+		*requests++
+		if r.URL.Path == "/client/v4/zones" {
+			return &http.Response{StatusCode: 200, Body: test.FromBytes([]byte(`{"result":[{"id":"zone12345"}],"success":true}`))}
+		}
+
+		q := r.URL.Query()
+		var matching []cloudflare.Record
+		for _, rec := range recs {
+			if !filter || (rec.Name == q.Get("name") && string(rec.Type) == q.Get("type")) {
+				matching = append(matching, rec)
+			}
+		}
+
+		var page, perPage int
+		_, _ = fmt.Sscan(q.Get("page"), &page)
+		_, _ = fmt.Sscan(q.Get("per_page"), &perPage)
+		start, end := (page-1)*perPage, page*perPage
+		if end > len(matching) {
+			end = len(matching)
+		}
+
+		resp := cloudflare.DNSResponse{}
+		result := matching[start:end]
+		resp.Result = &result
+		resp.Success = true
+		resp.ResultInfo = &struct {
+			Page       int `json:"page"`
+			TotalPages int `json:"total_pages"`
+		}{Page: page, TotalPages: (len(matching) + perPage - 1) / perPage}
+		body, _ := json.Marshal(resp)
+
+		return &http.Response{StatusCode: 200, Body: test.FromBytes(body)}
+	}
+}
+
+func Benchmark_ClientGetRecord(b *testing.B) {
+	for _, bb := range []struct {
+		name   string
+		filter bool
+	}{
+		{name: "server-side filtering", filter: true},
+		{name: "whole zone listing", filter: false},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			requests := 0
+			client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(zoneTransport(2000, bb.filter, &requests))))
+
+			for i := 0; i < b.N; i++ {
+				if _, err := client.GetRecord(context.Background(), "home.nenad.dev", cloudflare.A); err != nil {
+					b.Fatalf("did not expect an error: %s", err)
+				}
+			}
+			b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+		})
+	}
+}
+
+func Test_ClientBaseURL(t *testing.T) {
+	client, _ := cloudflare.NewClient(
+		cloudflare.Token("token"),
+		cloudflare.BaseURL("http://proxy.internal/cloudflare/"),
+		cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+			if want := "http://proxy.internal/cloudflare/zones?name=nenad.dev"; r.URL.String() != want {
+				t.Errorf("URL mismatch, want %q, got %q", want, r.URL.String())
+			}
+
+			return &http.Response{StatusCode: 200, Body: test.FromBytes([]byte(`{"result":[],"success":true}`))}
+		})),
+	)
 
+	_, _ = client.GetRecord(context.Background(), "nenad.dev", cloudflare.A)
+}
+
+func Test_ClientListRecords(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	for i := 0; i < 120; i++ {
+		fake.AddRecord(cloudflare.Record{Name: fmt.Sprintf("host%d.nenad.dev", i), Type: cloudflare.A, Content: "10.0.0.1"})
+	}
+	fake.AddRecord(cloudflare.Record{Name: "nenad.dev", Type: cloudflare.MX, Content: "mail.nenad.dev"})
+	fake.AddRecord(cloudflare.Record{Name: "host7.nenad.dev", Type: cloudflare.AAAA, Content: "::1"})
+	fake.AddRecord(cloudflare.Record{Name: "other.dev", Type: cloudflare.A, Content: "10.0.0.2"})
+
+	tests := []struct {
+		name   string
+		filter cloudflare.RecordFilter
+		want   int
+	}{
+		{name: "every record of the zone across pages", want: 122},
+		{name: "records of a type", filter: cloudflare.RecordFilter{Type: cloudflare.A}, want: 120},
+		{name: "records of a name", filter: cloudflare.RecordFilter{Name: "host7.nenad.dev"}, want: 2},
+		{name: "records of a name and type", filter: cloudflare.RecordFilter{Name: "host7.nenad.dev", Type: cloudflare.AAAA}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, err := fakeClient(t, fake).ListRecords(context.Background(), "nenad.dev", tt.filter)
+			if err != nil {
+				t.Fatalf("could not list records: %s", err)
+			}
+
+			if len(recs) != tt.want {
+				t.Fatalf("want %d records, got %d", tt.want, len(recs))
+			}
+			for _, rec := range recs {
+				if rec.ZoneName != "nenad.dev" || !tt.filter.Matches(rec) {
+					t.Errorf("unexpected record %s %s in listing", rec.Name, rec.Type)
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,108 @@
+package cloudflare
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when CloudFlare responds with an error.
+type APIError struct {
+	StatusCode int     // StatusCode is the HTTP status of the response.
+	Method     string  // Method is the HTTP method of the request.
+	Path       string  // Path is the path of the request, without the query.
+	RayID      string  // RayID is the CF-Ray ID of the response, to quote to CloudFlare support.
+	Errors     []Error // Errors are the errors listed in the response.
+	Message    string  // Message describes responses that are not API responses, such as HTML error pages.
+}
+
+// Error codes returned by CloudFlare.
+const (
+	CodeAuthentication      = 10000
+	CodeUnknownAuthKey      = 9103
+	CodeMissingAuthKey      = 9106
+	CodeInvalidAccessToken  = 9109
+	CodeRecordNotFound      = 81044
+	CodeRecordAlreadyExists = 81057
+	CodeIdenticalRecord     = 81058
+)
+
+// Error returns the request, the status and the codes and messages of all errors, including their chains.
+func (e *APIError) Error() string {
+	b := &strings.Builder{}
+	_, _ = fmt.Fprintf(b, "error from CloudFlare: %s %s: status %d", e.Method, e.Path, e.StatusCode)
+	if e.RayID != "" {
+		_, _ = fmt.Fprintf(b, " (CF-Ray %s)", e.RayID)
+	}
+	if e.Message != "" {
+		_, _ = fmt.Fprintf(b, ": %s", e.Message)
+	}
+	for _, err := range e.Errors {
+		_, _ = fmt.Fprintf(b, ": [%d] %s", err.Code, err.Message)
+		for _, chained := range err.ErrorChain {
+			_, _ = fmt.Fprintf(b, ": [%d] %s", chained.Code, chained.Message)
+		}
+	}
+
+	return b.String()
+}
+
+// HasCode reports whether any of the errors, or their chains, has one of the given codes.
+func (e *APIError) HasCode(codes ...int) bool {
+	for _, err := range e.Errors {
+		for _, c := range codes {
+			if err.Code == c {
+				return true
+			}
+			for _, chained := range err.ErrorChain {
+				if chained.Code == c {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// IsAuthError reports whether the error was caused by CloudFlare rejecting the credentials.
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden ||
+		apiErr.HasCode(CodeAuthentication, CodeUnknownAuthKey, CodeMissingAuthKey, CodeInvalidAccessToken)
+}
+
+// IsNotFound reports whether the error was caused by a resource that does not exist.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.HasCode(CodeRecordNotFound)
+}
+
+// IsRateLimited reports whether the error was caused by exceeding CloudFlare's rate limits.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsAlreadyExists reports whether the error was caused by creating a record that already exists.
+func IsAlreadyExists(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.HasCode(CodeRecordAlreadyExists, CodeIdenticalRecord)
+}
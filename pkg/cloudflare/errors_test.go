@@ -0,0 +1,160 @@
+package cloudflare_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/test"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantAuth      bool
+		wantNotFound  bool
+		wantRateLimit bool
+		wantExists    bool
+		wantMessage   string
+	}{
+		{
+			name:        "invalid token is an auth error",
+			status:      403,
+			body:        `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`,
+			wantAuth:    true,
+			wantMessage: "status 403: [9109] Invalid access token",
+		},
+		{
+			name:        "authentication error code is an auth error regardless of status",
+			status:      400,
+			body:        `{"success":false,"errors":[{"code":6003,"message":"Invalid request headers","error_chain":[{"code":10000,"message":"Authentication error"}]}]}`,
+			wantAuth:    true,
+			wantMessage: "[6003] Invalid request headers: [10000] Authentication error",
+		},
+		{
+			name:         "missing record is not found",
+			status:       404,
+			body:         `{"success":false,"errors":[{"code":81044,"message":"Record does not exist."}]}`,
+			wantNotFound: true,
+		},
+		{
+			name:          "too many requests is rate limited",
+			status:        429,
+			body:          `{"success":false,"errors":[{"code":971,"message":"Please wait and consider throttling your request speed"}]}`,
+			wantRateLimit: true,
+		},
+		{
+			name:       "existing record is reported",
+			status:     400,
+			body:       `{"success":false,"errors":[{"code":81057,"message":"Record already exists."}]}`,
+			wantExists: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+				return &http.Response{StatusCode: tt.status, Body: test.FromBytes([]byte(tt.body))}
+			})))
+
+			_, err := client.GetRecord(context.Background(), "home.nenad.dev", cloudflare.A)
+
+			var apiErr *cloudflare.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an APIError, got %#v", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Path != "/client/v4/zones" {
+				t.Errorf("unexpected status %d or path %q", apiErr.StatusCode, apiErr.Path)
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("expected error to contain %q, got %q", tt.wantMessage, err)
+			}
+
+			if cloudflare.IsAuthError(err) != tt.wantAuth {
+				t.Errorf("IsAuthError() = %t, want %t", !tt.wantAuth, tt.wantAuth)
+			}
+			if cloudflare.IsNotFound(err) != tt.wantNotFound {
+				t.Errorf("IsNotFound() = %t, want %t", !tt.wantNotFound, tt.wantNotFound)
+			}
+			if cloudflare.IsRateLimited(err) != tt.wantRateLimit {
+				t.Errorf("IsRateLimited() = %t, want %t", !tt.wantRateLimit, tt.wantRateLimit)
+			}
+			if cloudflare.IsAlreadyExists(err) != tt.wantExists {
+				t.Errorf("IsAlreadyExists() = %t, want %t", !tt.wantExists, tt.wantExists)
+			}
+		})
+	}
+}
+
+type trackedBody struct {
+	*test.Body
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return b.Body.Close()
+}
+
+func TestAPIError_EdgeResponses(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantMessage string
+	}{
+		{
+			name:        "HTML error page from the edge is reported with its status",
+			status:      502,
+			contentType: "text/html",
+			body:        "<html><body>Bad gateway</body></html>",
+			wantMessage: `status 502 (CF-Ray 5f0a1b2c3d4e5f60-AMS): unexpected "text/html" response`,
+		},
+		{
+			name:        "undecodable error response is reported with its status",
+			status:      500,
+			contentType: "application/json",
+			body:        "{",
+			wantMessage: "status 500 (CF-Ray 5f0a1b2c3d4e5f60-AMS): could not decode response",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			body := &trackedBody{Body: test.FromBytes([]byte(tt.body))}
+			client, _ := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+				return &http.Response{
+					StatusCode: tt.status,
+					Header: http.Header{
+						"Content-Type": {tt.contentType},
+						"Cf-Ray":       {"5f0a1b2c3d4e5f60-AMS"},
+					},
+					Body: body,
+				}
+			})))
+
+			_, err := client.GetRecord(context.Background(), "home.nenad.dev", cloudflare.A)
+
+			var apiErr *cloudflare.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an APIError, got %#v", err)
+			}
+			if apiErr.RayID != "5f0a1b2c3d4e5f60-AMS" {
+				t.Errorf("expected CF-Ray ID in the error, got %q", apiErr.RayID)
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("expected error to contain %q, got %q", tt.wantMessage, err)
+			}
+			if !body.closed {
+				t.Errorf("response body was not closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package cloudflare_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/test"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func fakeClient(t *testing.T, fake *test.CloudFlare, options ...func(*cloudflare.API)) *cloudflare.API {
+	options = append([]func(*cloudflare.API){cloudflare.Token("token"), cloudflare.BaseURL(fake.URL())}, options...)
+	client, err := cloudflare.NewClient(options...)
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	return client
+}
+
+func TestFake_RecordLifecycle(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	for i := 0; i < 120; i++ {
+		fake.AddRecord(cloudflare.Record{Name: fmt.Sprintf("host%d.nenad.dev", i), Type: cloudflare.A, Content: "10.0.0.1"})
+	}
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: "hand-written"})
+
+	ctx := context.Background()
+	client := fakeClient(t, fake)
+
+	rec, err := client.GetRecord(ctx, "home.nenad.dev", cloudflare.A)
+	if err != nil {
+		t.Fatalf("could not get record: %s", err)
+	}
+
+	desired := rec
+	desired.Content = "192.168.0.2"
+	if err := client.UpdateRecord(ctx, rec, cloudflare.Diff(rec, desired)); err != nil {
+		t.Fatalf("could not update record: %s", err)
+	}
+
+	created, err := client.CreateRecord(ctx, cloudflare.DNSUpdateRequest{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.3"})
+	if err != nil {
+		t.Fatalf("could not create record: %s", err)
+	}
+
+	recs, err := client.GetRecords(ctx, "home.nenad.dev", cloudflare.A)
+	if err != nil {
+		t.Fatalf("could not get records: %s", err)
+	}
+
+	if len(recs) != 2 || recs[0].Content != "192.168.0.2" || recs[0].Comment != "hand-written" || recs[1].ID != created.ID {
+		t.Fatalf("unexpected records after update and create: %#v", recs)
+	}
+
+	if _, err := client.CreateRecord(ctx, cloudflare.DNSUpdateRequest{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.3"}); !cloudflare.IsAlreadyExists(err) {
+		t.Fatalf("expected an already exists error, got %v", err)
+	}
+
+	if err := client.DeleteRecord(ctx, created); err != nil {
+		t.Fatalf("could not delete record: %s", err)
+	}
+	if recs, err := client.GetRecords(ctx, "home.nenad.dev", cloudflare.A); err != nil || len(recs) != 1 || recs[0].ID != rec.ID {
+		t.Fatalf("unexpected records after delete: %#v (%v)", recs, err)
+	}
+}
+
+func TestFake_InjectedFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure test.Failure
+		retry   bool
+		check   func(err error) bool
+	}{
+		{
+			name:    "rate limit is retried",
+			failure: test.Failure{Status: 429, Code: 971, Message: "Please wait and consider throttling your request speed"},
+			retry:   true,
+			check:   func(err error) bool { return err == nil },
+		},
+		{
+			name:    "edge failure is retried",
+			failure: test.Failure{Status: 502},
+			retry:   true,
+			check:   func(err error) bool { return err == nil },
+		},
+		{
+			name:    "edge failure without retries is an API error",
+			failure: test.Failure{Status: 502},
+			check: func(err error) bool {
+				var apiErr *cloudflare.APIError
+				return errors.As(err, &apiErr) && apiErr.StatusCode == 502 && apiErr.RayID != ""
+			},
+		},
+		{
+			name:    "authentication failure is an auth error",
+			failure: test.Failure{Method: "GET", Path: "/zones", Status: 403, Code: cloudflare.CodeInvalidAccessToken, Message: "Invalid access token"},
+			retry:   true,
+			check:   cloudflare.IsAuthError,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fake := test.NewCloudFlare("token")
+			defer fake.Close()
+			fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1"})
+			fake.Fail(tt.failure)
+
+			client := fakeClient(t, fake)
+			if tt.retry {
+				client = fakeClient(t, fake, cloudflare.Client(&http.Client{Timeout: 5 * time.Second}), cloudflare.Retry(2))
+			}
+
+			_, err := client.GetRecord(context.Background(), "home.nenad.dev", cloudflare.A)
+			if !tt.check(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
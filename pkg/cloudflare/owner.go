@@ -0,0 +1,98 @@
+package cloudflare
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// OwnerTagName is the name of the tag marking records managed by cloudflare-ddns.
+	OwnerTagName = "cloudflare-ddns"
+
+	commentPrefix = "managed by cloudflare-ddns"
+	commentHost   = " from host "
+)
+
+// OwnerTag returns the ownership tag for records managed by the given owner.
+func OwnerTag(owner string) string {
+	return fmt.Sprintf("%s:%s", OwnerTagName, owner)
+}
+
+// WithOwnerTag returns the tags with any existing ownership tag replaced by the one for the given owner.
+// The ownership tag keeps the position of the one it replaces, and is added last if there is none.
+func WithOwnerTag(tags []string, owner string) []string {
+	var result []string
+	tagged := false
+	for _, t := range tags {
+		if name, _ := splitTag(t); name != OwnerTagName {
+			result = append(result, t)
+		} else if !tagged {
+			result = append(result, OwnerTag(owner))
+			tagged = true
+		}
+	}
+
+	if !tagged {
+		result = append(result, OwnerTag(owner))
+	}
+
+	return result
+}
+
+// ManagedComment returns the comment stamped on records updated by the given host at the given time.
+func ManagedComment(host string, t time.Time) string {
+	return fmt.Sprintf("%s, updated %s%s%s", commentPrefix, t.UTC().Format("2006-01-02T15:04Z07:00"), commentHost, host)
+}
+
+// Owner returns the owner named in the record's ownership tag or managed comment,
+// and whether the record carries either marker. The tag takes precedence over the comment.
+func (r Record) Owner() (string, bool) {
+	for _, t := range r.Tags {
+		if name, value := splitTag(t); name == OwnerTagName {
+			return value, true
+		}
+	}
+
+	if !strings.HasPrefix(r.Comment, commentPrefix) {
+		return "", false
+	}
+
+	if i := strings.LastIndex(r.Comment, commentHost); i >= 0 {
+		return r.Comment[i+len(commentHost):], true
+	}
+
+	return "", true
+}
+
+// FindOwned returns the record in the set that belongs to the given owner, and whether one was found.
+// A record is recognized by its ownership marker, or failing that, by having the previously
+// published content while not being marked as owned by someone else.
+func FindOwned(recs []Record, owner, previous string) (Record, bool) {
+	for _, r := range recs {
+		if o, ok := r.Owner(); ok && o == owner {
+			return r, true
+		}
+	}
+
+	if previous == "" {
+		return Record{}, false
+	}
+
+	for _, r := range recs {
+		if _, ok := r.Owner(); !ok && r.Content == previous {
+			return r, true
+		}
+	}
+
+	return Record{}, false
+}
+
+func splitTag(tag string) (name, value string) {
+	parts := strings.SplitN(tag, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
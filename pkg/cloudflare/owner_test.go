@@ -0,0 +1,132 @@
+package cloudflare_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecord_Owner(t *testing.T) {
+	tests := []struct {
+		name      string
+		tags      []string
+		comment   string
+		wantOwner string
+		wantOK    bool
+	}{
+		{
+			name: "record without tags has no owner",
+		},
+		{
+			name: "record with unrelated tags has no owner",
+			tags: []string{"env:prod", "cloudflare"},
+		},
+		{
+			name:      "record with ownership tag returns the owner",
+			tags:      []string{"env:prod", "cloudflare-ddns:router"},
+			wantOwner: "router",
+			wantOK:    true,
+		},
+		{
+			name:    "record with a hand-written comment has no owner",
+			comment: "home router, do not touch",
+		},
+		{
+			name:      "record with managed comment returns the host as owner",
+			comment:   "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host laptop",
+			wantOwner: "laptop",
+			wantOK:    true,
+		},
+		{
+			name:      "ownership tag takes precedence over the comment",
+			tags:      []string{"cloudflare-ddns:router"},
+			comment:   "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host laptop",
+			wantOwner: "router",
+			wantOK:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, ok := cloudflare.Record{Tags: tt.tags, Comment: tt.comment}.Owner()
+			if owner != tt.wantOwner || ok != tt.wantOK {
+				t.Fatalf("want (%q, %t), got (%q, %t)", tt.wantOwner, tt.wantOK, owner, ok)
+			}
+		})
+	}
+}
+
+func TestWithOwnerTag(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{tags: []string{"env:prod", "cloudflare-ddns:laptop"}, want: []string{"env:prod", "cloudflare-ddns:router"}},
+		{tags: []string{"cloudflare-ddns:laptop", "env:prod", "cloudflare-ddns:nas"}, want: []string{"cloudflare-ddns:router", "env:prod"}},
+		{tags: []string{"env:prod"}, want: []string{"env:prod", "cloudflare-ddns:router"}},
+		{tags: nil, want: []string{"cloudflare-ddns:router"}},
+	}
+
+	for _, tt := range tests {
+		if got := cloudflare.WithOwnerTag(tt.tags, "router"); !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("tags mismatch for %q; want %q, got %q", tt.tags, tt.want, got)
+		}
+	}
+}
+
+func TestManagedComment(t *testing.T) {
+	got := cloudflare.ManagedComment("router", time.Date(2026, 10, 18, 12, 0, 30, 0, time.UTC))
+	want := "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host router"
+	if got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestFindOwned(t *testing.T) {
+	recs := []cloudflare.Record{
+		{ID: "wan1", Content: "192.168.0.1", Tags: []string{"cloudflare-ddns:laptop"}},
+		{ID: "wan2", Content: "192.168.0.2"},
+		{ID: "wan3", Content: "192.168.0.3", Comment: "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host router"},
+	}
+
+	tests := []struct {
+		name     string
+		owner    string
+		previous string
+		wantID   string
+		wantOK   bool
+	}{
+		{
+			name:   "record marked by the owner is found",
+			owner:  "router",
+			wantID: "wan3",
+			wantOK: true,
+		},
+		{
+			name:     "unmarked record with the previous content is found",
+			owner:    "desktop",
+			previous: "192.168.0.2",
+			wantID:   "wan2",
+			wantOK:   true,
+		},
+		{
+			name:     "record marked by another owner is never found by content",
+			owner:    "desktop",
+			previous: "192.168.0.1",
+		},
+		{
+			name:  "no record is found for a new owner",
+			owner: "desktop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cloudflare.FindOwned(recs, tt.owner, tt.previous)
+			if got.ID != tt.wantID || ok != tt.wantOK {
+				t.Fatalf("want (%q, %t), got (%q, %t)", tt.wantID, tt.wantOK, got.ID, ok)
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package cloudflare
 
+import (
+	"reflect"
+	"time"
+)
+
 const (
 	A     Type = "A"
 	AAAA  Type = "AAAA"
@@ -28,24 +33,155 @@ type (
 		Messages []interface{} `json:"messages"`
 	}
 
+	// RecordFilter selects records when listing a zone, empty fields match any record.
+	RecordFilter struct {
+		Name string
+		Type Type
+	}
+
+	// responder is implemented by all responses through the embedded Response.
+	responder interface {
+		response() *Response
+	}
+
 	// DNSResponse is the response returned from the `GET zones/:zone_identifier/dns_records` endpoint
 	DNSResponse struct {
 		Response
 		Result *[]Record `json:"result"`
 	}
-	// DNSUpdateRequest updates a DNS entry calling the `PUT zones/:zone_identifier/dns_records/:identifier` endpoint
+	// ZoneResponse is the response returned from the `GET zones` endpoint
+	ZoneResponse struct {
+		Response
+		Result []Zone `json:"result"`
+	}
+	// A Zone holds the details of a CloudFlare zone
+	Zone struct {
+		ID          string   `json:"id"`
+		Name        string   `json:"name"`
+		Status      string   `json:"status"`
+		Permissions []string `json:"permissions"`
+	}
+	// DNSRecordResponse is the response returned from endpoints operating on a single DNS record
+	DNSRecordResponse struct {
+		Response
+		Result Record `json:"result"`
+	}
+	// DNSUpdateRequest updates a DNS entry calling the `PATCH zones/:zone_identifier/dns_records/:identifier` endpoint.
+	// Only the fields that are set are sent, leaving the rest of the record untouched.
+	// It is also used for creating records with the `POST zones/:zone_identifier/dns_records` endpoint.
 	DNSUpdateRequest struct {
-		Name    string `json:"name"`
-		Type    Type   `json:"type"`
-		Content string `json:"content"`
-		Proxied bool   `json:"proxied"`
-		TTL     int    `json:"ttl"`
+		Name     string                  `json:"name,omitempty"`
+		Type     Type                    `json:"type,omitempty"`
+		Content  string                  `json:"content,omitempty"`
+		Priority *uint16                 `json:"priority,omitempty"` // Priority is 0 to remove it.
+		Data     *map[string]interface{} `json:"data,omitempty"`     // Data replaces the data of the record, an empty map removes it.
+		Proxied  *bool                   `json:"proxied,omitempty"`
+		TTL      int                     `json:"ttl,omitempty"`
+		Comment  *string                 `json:"comment,omitempty"`
+		Tags     *[]string               `json:"tags,omitempty"` // Tags replace every tag of the record, an empty list removes them.
 	}
 	// A Record represents a DNS record
 	Record struct {
-		ID      string `json:"id"`
-		Type    Type   `json:"type"`
-		Name    string `json:"name"`
-		Content string `json:"content"`
+		ID         string                 `json:"id"`
+		ZoneID     string                 `json:"zone_id,omitempty"`
+		ZoneName   string                 `json:"zone_name,omitempty"`
+		Type       Type                   `json:"type"`
+		Name       string                 `json:"name"`
+		Content    string                 `json:"content"`
+		Priority   *uint16                `json:"priority,omitempty"`
+		Data       map[string]interface{} `json:"data,omitempty"`
+		Proxiable  bool                   `json:"proxiable"`
+		Proxied    bool                   `json:"proxied"`
+		TTL        int                    `json:"ttl"`
+		Locked     bool                   `json:"locked"`
+		Comment    string                 `json:"comment"`
+		Tags       []string               `json:"tags"`
+		Meta       map[string]interface{} `json:"meta,omitempty"`
+		CreatedOn  time.Time              `json:"created_on"`
+		ModifiedOn time.Time              `json:"modified_on"`
 	}
 )
+
+func (r *Response) response() *Response {
+	return r
+}
+
+// Diff returns the request that changes the current record into the desired one.
+// Fields that are equal in both records are left out of the request.
+func Diff(current, desired Record) DNSUpdateRequest {
+	req := DNSUpdateRequest{}
+	if current.Name != desired.Name {
+		req.Name = desired.Name
+	}
+	if current.Type != desired.Type {
+		req.Type = desired.Type
+	}
+	if current.Content != desired.Content {
+		req.Content = desired.Content
+	}
+	if priority(current) != priority(desired) {
+		p := priority(desired)
+		req.Priority = &p
+	}
+	if (len(current.Data) > 0 || len(desired.Data) > 0) && !reflect.DeepEqual(current.Data, desired.Data) {
+		data := map[string]interface{}{}
+		for k, v := range desired.Data {
+			data[k] = v
+		}
+		req.Data = &data
+	}
+	if current.Proxied != desired.Proxied {
+		req.Proxied = &desired.Proxied
+	}
+	if current.TTL != desired.TTL {
+		req.TTL = desired.TTL
+	}
+	if current.Comment != desired.Comment {
+		req.Comment = &desired.Comment
+	}
+	if !sameTags(current.Tags, desired.Tags) {
+		// A non-nil empty list is sent as [], clearing the tags, where a nil one would be left out.
+		tags := append([]string{}, desired.Tags...)
+		req.Tags = &tags
+	}
+
+	return req
+}
+
+// sameTags reports whether both lists hold the same tags, in any order, as the order of tags has no meaning.
+func sameTags(a, b []string) bool {
+	set := map[string]bool{}
+	for _, t := range a {
+		set[t] = true
+	}
+	for _, t := range b {
+		if !set[t] {
+			return false
+		}
+	}
+
+	others := map[string]bool{}
+	for _, t := range b {
+		others[t] = true
+	}
+	return len(set) == len(others)
+}
+
+// priority returns the priority of the record, 0 if it has none.
+func priority(rec Record) uint16 {
+	if rec.Priority == nil {
+		return 0
+	}
+
+	return *rec.Priority
+}
+
+// IsEmpty reports whether the request does not change anything.
+func (r DNSUpdateRequest) IsEmpty() bool {
+	return reflect.DeepEqual(r, DNSUpdateRequest{})
+}
+
+// Matches reports whether the record has the name and type of the filter.
+func (f RecordFilter) Matches(rec Record) bool {
+	return (f.Name == "" || f.Name == rec.Name) && (f.Type == "" || f.Type == rec.Type)
+}
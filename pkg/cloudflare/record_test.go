@@ -0,0 +1,133 @@
+package cloudflare_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	current := cloudflare.Record{
+		ID:      "a3bfb90b2b9d",
+		Type:    cloudflare.A,
+		Name:    "nenad.dev",
+		Content: "192.168.0.2",
+		Proxied: true,
+		TTL:     1,
+		Comment: "hand-written comment",
+		Tags:    []string{"env:prod"},
+	}
+	proxied := false
+	comment := "managed by cloudflare-ddns"
+	priority := uint16(10)
+
+	tests := []struct {
+		name   string
+		change func(r *cloudflare.Record)
+		want   cloudflare.DNSUpdateRequest
+	}{
+		{
+			name:   "unchanged record produces an empty request",
+			change: func(r *cloudflare.Record) {},
+			want:   cloudflare.DNSUpdateRequest{},
+		},
+		{
+			name: "only changed fields are included",
+			change: func(r *cloudflare.Record) {
+				r.Content = "192.168.0.3"
+				r.Proxied = false
+				r.Comment = comment
+			},
+			want: cloudflare.DNSUpdateRequest{
+				Content: "192.168.0.3",
+				Proxied: &proxied,
+				Comment: &comment,
+			},
+		},
+		{
+			name: "changed tags are sent in full",
+			change: func(r *cloudflare.Record) {
+				r.Tags = []string{"cloudflare-ddns:router", "env:prod"}
+				r.TTL = 300
+			},
+			want: cloudflare.DNSUpdateRequest{
+				TTL:  300,
+				Tags: &[]string{"cloudflare-ddns:router", "env:prod"},
+			},
+		},
+		{
+			name: "changed priority is sent",
+			change: func(r *cloudflare.Record) {
+				r.Priority = &priority
+			},
+			want: cloudflare.DNSUpdateRequest{Priority: &priority},
+		},
+		{
+			name: "removed tags are cleared",
+			change: func(r *cloudflare.Record) {
+				r.Tags = nil
+			},
+			want: cloudflare.DNSUpdateRequest{Tags: &[]string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := current
+			tt.change(&desired)
+
+			got := cloudflare.Diff(current, desired)
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Fatalf("request mismatch; want %#v, got %#v", tt.want, got)
+			}
+			if got.IsEmpty() != reflect.DeepEqual(tt.want, cloudflare.DNSUpdateRequest{}) {
+				t.Fatalf("IsEmpty() mismatch for %#v", got)
+			}
+		})
+	}
+}
+
+func TestDiff_Tags(t *testing.T) {
+	untagged := cloudflare.Record{Type: cloudflare.A, Name: "nenad.dev", Content: "192.168.0.2"}
+	tagged := untagged
+	tagged.Tags = []string{"env:prod"}
+
+	if req := cloudflare.Diff(untagged, cloudflare.Record{Type: cloudflare.A, Name: "nenad.dev", Content: "192.168.0.2", Tags: []string{}}); !req.IsEmpty() {
+		t.Errorf("expected missing and empty tags to be equal, got %#v", req)
+	}
+
+	reordered := tagged
+	reordered.Tags = []string{"cloudflare-ddns:router", "env:prod"}
+	tagged.Tags = []string{"env:prod", "cloudflare-ddns:router"}
+	if req := cloudflare.Diff(tagged, reordered); !req.IsEmpty() {
+		t.Errorf("expected tags in another order to be equal, got %#v", req)
+	}
+
+	body, err := json.Marshal(cloudflare.Diff(tagged, untagged))
+	if err != nil {
+		t.Fatalf("could not marshal request: %s", err)
+	}
+	if string(body) != `{"tags":[]}` {
+		t.Errorf("expected the tags to be cleared with an empty list, got %s", body)
+	}
+}
+
+func TestDiff_ClearsPriorityAndData(t *testing.T) {
+	priority := uint16(10)
+	current := cloudflare.Record{
+		Type:     cloudflare.Type("SRV"),
+		Name:     "_sip._tcp.nenad.dev",
+		Priority: &priority,
+		Data:     map[string]interface{}{"port": 5060.0, "target": "sip.nenad.dev"},
+	}
+	desired := cloudflare.Record{Type: cloudflare.Type("SRV"), Name: "_sip._tcp.nenad.dev"}
+
+	body, err := json.Marshal(cloudflare.Diff(current, desired))
+	if err != nil {
+		t.Fatalf("could not marshal request: %s", err)
+	}
+	if string(body) != `{"priority":0,"data":{}}` {
+		t.Errorf("expected the priority and data to be cleared, got %s", body)
+	}
+}
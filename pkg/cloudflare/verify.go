@@ -0,0 +1,115 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RequiredPermissions are the zone permissions needed for updating DNS records.
+var RequiredPermissions = []string{"#zone:read", "#dns_records:read", "#dns_records:edit"}
+
+type (
+	// TokenResponse is the response returned from the `GET user/tokens/verify` endpoint
+	TokenResponse struct {
+		Response
+		Result struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"result"`
+	}
+
+	// Verification is the outcome of checking the configured credentials against a domain's zone.
+	Verification struct {
+		Domain      string
+		Zone        Zone
+		TokenStatus string   // TokenStatus is empty when not authenticating with API tokens.
+		Missing     []string // Missing lists required permissions that are not granted on the zone.
+		Unverified  []string // Unverified lists required permissions that CloudFlare did not report either way.
+		Err         error    // Err is set when the token or the zone could not be checked at all.
+	}
+)
+
+// Verify checks that the credentials are valid and can read the zone and edit DNS records of the domain.
+// Any problems found are reported in the returned Verification.
+func (a *API) Verify(ctx context.Context, domain string) Verification {
+	v := Verification{Domain: domain}
+	ctx = withZone(ctx, domain)
+
+	if _, ok := a.auth.(GlobalKey); !ok {
+		resp := TokenResponse{}
+		if err := a.send(ctx, "GET", a.api("/user/tokens/verify"), nil, &resp); err != nil {
+			v.Err = fmt.Errorf("could not verify token: %w", err)
+			return v
+		}
+
+		v.TokenStatus = resp.Result.Status
+		if v.TokenStatus != "active" {
+			v.Err = fmt.Errorf("token is %s", v.TokenStatus)
+			return v
+		}
+	}
+
+	zone, err := a.zoneDetails(ctx, domain)
+	if err != nil {
+		v.Err = fmt.Errorf("could not read zone %q: %w", ZoneName(domain), err)
+		v.Missing = []string{"#zone:read"}
+		return v
+	}
+	v.Zone = zone
+
+	// CloudFlare does not always report the caller's permissions on a zone, in which case only
+	// reading the zone could be verified, and editing DNS records may still fail.
+	if zone.Permissions == nil {
+		for _, p := range RequiredPermissions {
+			if p != "#zone:read" {
+				v.Unverified = append(v.Unverified, p)
+			}
+		}
+		return v
+	}
+
+	granted := map[string]bool{}
+	for _, p := range zone.Permissions {
+		granted[p] = true
+	}
+	for _, p := range RequiredPermissions {
+		if !granted[p] {
+			v.Missing = append(v.Missing, p)
+		}
+	}
+
+	return v
+}
+
+// OK reports whether the credentials were verified to be usable for updating the domain.
+// Permissions that could not be verified make the verification fail as well.
+func (v Verification) OK() bool {
+	return v.Err == nil && len(v.Missing) == 0 && len(v.Unverified) == 0
+}
+
+// String returns a human readable report of the verification.
+func (v Verification) String() string {
+	b := &strings.Builder{}
+	_, _ = fmt.Fprintf(b, "%s:\n", v.Domain)
+	if v.TokenStatus != "" {
+		_, _ = fmt.Fprintf(b, "\ttoken: %s\n", v.TokenStatus)
+	}
+	if v.Zone.ID != "" {
+		_, _ = fmt.Fprintf(b, "\tzone: %s (%s)\n", v.Zone.Name, v.Zone.ID)
+	}
+	if v.Err != nil {
+		_, _ = fmt.Fprintf(b, "\terror: %s\n", v.Err)
+	}
+	if len(v.Missing) > 0 {
+		_, _ = fmt.Fprintf(b, "\tmissing permissions: %s\n", strings.Join(v.Missing, ", "))
+	}
+	if len(v.Unverified) > 0 {
+		_, _ = fmt.Fprintf(b, "\tunverified permissions, not reported by CloudFlare: %s\n", strings.Join(v.Unverified, ", "))
+	}
+	if v.OK() {
+		_, _ = fmt.Fprintf(b, "\tOK\n")
+	}
+
+	return b.String()
+}
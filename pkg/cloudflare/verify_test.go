@@ -0,0 +1,91 @@
+package cloudflare_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/test"
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAPI_Verify(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        cloudflare.Authenticator
+		token       string
+		zones       string
+		wantOK      bool
+		wantMissing []string
+		wantUnknown []string
+		wantToken   string
+	}{
+		{
+			name:      "active token with all permissions is OK",
+			auth:      cloudflare.BearerToken("token"),
+			token:     `{"result":{"id":"t1","status":"active"},"success":true}`,
+			zones:     `{"result":[{"id":"zone12345","name":"nenad.dev","permissions":["#zone:read","#dns_records:read","#dns_records:edit"]}],"success":true}`,
+			wantOK:    true,
+			wantToken: "active",
+		},
+		{
+			name:        "token without DNS edit permission reports it as missing",
+			auth:        cloudflare.BearerToken("token"),
+			token:       `{"result":{"id":"t1","status":"active"},"success":true}`,
+			zones:       `{"result":[{"id":"zone12345","name":"nenad.dev","permissions":["#zone:read","#dns_records:read"]}],"success":true}`,
+			wantMissing: []string{"#dns_records:edit"},
+			wantToken:   "active",
+		},
+		{
+			name:        "token that cannot see the zone is missing zone read",
+			auth:        cloudflare.BearerToken("token"),
+			token:       `{"result":{"id":"t1","status":"active"},"success":true}`,
+			zones:       `{"result":[],"success":true}`,
+			wantMissing: []string{"#zone:read"},
+			wantToken:   "active",
+		},
+		{
+			name:        "zone without permissions leaves editing DNS records unverified",
+			auth:        cloudflare.BearerToken("token"),
+			token:       `{"result":{"id":"t1","status":"active"},"success":true}`,
+			zones:       `{"result":[{"id":"zone12345","name":"nenad.dev"}],"success":true}`,
+			wantUnknown: []string{"#dns_records:read", "#dns_records:edit"},
+			wantToken:   "active",
+		},
+		{
+			name:      "disabled token is not OK",
+			auth:      cloudflare.BearerToken("token"),
+			token:     `{"result":{"id":"t1","status":"disabled"},"success":true}`,
+			wantToken: "disabled",
+		},
+		{
+			name:   "global key skips token verification",
+			auth:   cloudflare.GlobalKey{Email: "me@nenad.dev", Key: "key"},
+			zones:  `{"result":[{"id":"zone12345","name":"nenad.dev","permissions":["#zone:read","#dns_records:read","#dns_records:edit"]}],"success":true}`,
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := cloudflare.NewClient(cloudflare.Authentication(tt.auth), cloudflare.Client(test.NewTestClient(func(r *http.Request) *http.Response {
+				body := tt.zones
+				if r.URL.Path == "/client/v4/user/tokens/verify" {
+					body = tt.token
+				}
+				if body == "" {
+					t.Errorf("unexpected request to %q", r.URL.String())
+				}
+
+				return &http.Response{StatusCode: 200, Body: test.FromBytes([]byte(body))}
+			})))
+
+			v := client.Verify(context.Background(), "home.nenad.dev")
+
+			if v.OK() != tt.wantOK || v.TokenStatus != tt.wantToken || !reflect.DeepEqual(v.Missing, tt.wantMissing) || !reflect.DeepEqual(v.Unverified, tt.wantUnknown) {
+				t.Fatalf("verification mismatch; want ok %t, token %q, missing %q, unverified %q, got:\n%s", tt.wantOK, tt.wantToken, tt.wantMissing, tt.wantUnknown, v)
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"cloudflare-ddns/pkg/cloudflare"
 	"cloudflare-ddns/pkg/ip"
+	"cloudflare-ddns/pkg/rfc2136"
+	"encoding/base64"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,54 +17,274 @@ import (
 type (
 	// CloudFlare domain settings
 	CloudFlare struct {
-		Domain    string
-		Token     string
-		Type      string
-		Timeout   time.Duration
-		Proxied   bool
-		TTL       int
-		IPVersion ip.Version
+		Domain     string
+		Auth       string            // Auth is the authentication strategy, either "token" or "key".
+		Token      string            // Token is the API token, used for zones without a zone token.
+		ZoneTokens map[string]string // ZoneTokens are API tokens by zone name.
+		Email      string            // Email of the account for authenticating with the Global API Key.
+		Key        string            // Key is the Global API Key.
+		BaseURL    string            // BaseURL is the URL of CloudFlare's API.
+		Type       string
+		Timeout    time.Duration
+		Proxied    bool
+		TTL        int
+		IPVersion  ip.Version
+		Owner      string // Owner identifies this host in record comments and ownership tags.
+		Comment    bool   // Comment stamps updated records with the owner and update time.
+		Tag        bool   // Tag marks updated records with the owner's ownership tag.
+		Force      bool   // Force updates records owned by someone else.
+		Adopt      bool   // Adopt updates records that carry no ownership marker.
+		RecordSet  bool   // RecordSet manages this host's entry among several records sharing the name.
+	}
+
+	// RFC2136 dynamic update settings, used with the rfc2136 provider.
+	RFC2136 struct {
+		Nameserver    string // Nameserver is the authoritative name server accepting updates, as host or host:port.
+		Zone          string // Zone the domain is updated in, the last two labels of the domain if empty.
+		TSIGKey       string // TSIGKey is the name of the key signing the updates, unsigned if empty.
+		TSIGSecret    string // TSIGSecret is the base64 encoded secret of the TSIG key.
+		TSIGAlgorithm string
+	}
+
+	// List selects the records shown by the list command.
+	List struct {
+		Zone   string // Zone whose records are listed.
+		Name   string // Name of the listed records, any name if empty.
+		Type   string // Type of the listed records, any type if empty.
+		Format string // Format of the output, "table", "json" or "bind".
+	}
+
+	// Snapshot selects the zone and file of the export and import commands.
+	Snapshot struct {
+		Zone    string // Zone that is exported or restored.
+		File    string // File the snapshot is written to or read from, "-" for standard output or input.
+		Format  string // Format of the snapshot, "json" or "bind".
+		Restore bool   // Restore applies the changes of an import instead of only showing them.
+	}
+
+	// Undo selects the records whose last update is undone.
+	Undo struct {
+		All   bool // All undoes the last update of every journaled record, instead of only the -domain record.
+		Force bool // Force restores records that were changed since their last journaled update.
+	}
+
+	// History selects the events shown by the history command.
+	History struct {
+		Domain string    // Domain of the events, any domain if empty.
+		Type   string    // Type of the record, any type if empty.
+		Since  time.Time // Since is the time of the oldest shown event, unbounded if zero.
+		Until  time.Time // Until is the time after the newest shown event, unbounded if zero.
 	}
 
 	// App configuration
 	App struct {
+		Provider     string // Provider is the DNS backend records are published to.
 		Interface    string // Interface which will be used to retrieve IP from.
 		CacheEnabled bool
+		CacheURL     string        // CacheURL selects the cache backend, JSON files in CacheDir if empty.
+		CacheDir     string        // CacheDir keeps the cache, journal and history, the default directory if empty.
+		Preflight    bool          // Preflight verifies the credentials once before the first update.
+		Interval     time.Duration // Interval between updates of the daemon.
+		Reconcile    time.Duration // Reconcile is how long a cached record is trusted before it is read again, forever if zero.
+	}
+
+	// Command describes a subcommand by its name, usage line and the groups of flags it accepts.
+	Command struct {
+		Name  string
+		Usage string
+		Flags Flags
 	}
 
+	// Flags is a set of flag groups.
+	Flags uint
+
 	Configuration struct {
 		CloudFlare CloudFlare
+		RFC2136    RFC2136
+		List       List
+		Snapshot   Snapshot
+		Undo       Undo
+		History    History
 		App        App
 	}
+
+	// zoneTokens collects repeated zone=token flag values.
+	zoneTokens map[string]string
+
+	// cacheFlag enables the cache as a boolean flag, or selects its backend with a URL.
+	cacheFlag struct {
+		enabled bool
+		url     string
+	}
 )
 
-// Parse generates configuration from the command arguments.
+const (
+	// AuthToken authenticates with API tokens.
+	AuthToken = "token"
+	// AuthKey authenticates with the Global API Key and the account's email.
+	AuthKey = "key"
+
+	// ProviderCloudFlare publishes records through CloudFlare's API.
+	ProviderCloudFlare = "cloudflare"
+	// ProviderRFC2136 publishes records with RFC 2136 dynamic updates to an authoritative name server.
+	ProviderRFC2136 = "rfc2136"
+)
+
+const (
+	// ProviderFlags select the DNS provider and its credentials.
+	ProviderFlags Flags = 1 << iota
+	// RecordFlags select the record by its domain and type.
+	RecordFlags
+	// CacheFlags enable the cache.
+	CacheFlags
+	// publishFlags control how the record is published and which records may be changed.
+	publishFlags
+	// DaemonFlags configure the daemon.
+	DaemonFlags
+	// ListFlags select records of a zone by name and type, and the output format.
+	// They cannot be combined with RecordFlags, which select a single record.
+	ListFlags
+	// SnapshotFlags select the file and format of a zone snapshot, and whether it is restored.
+	// They cannot be combined with ListFlags, which define their own output format.
+	SnapshotFlags
+	// UndoFlags select every journaled record instead of the one of RecordFlags, which they require.
+	UndoFlags
+	// HistoryFlags select events by domain, type and time range.
+	// They cannot be combined with RecordFlags, which require a domain.
+	HistoryFlags
+	// StateFlags select the directory of the cache, journal and history.
+	StateFlags
+
+	// UpdateFlags are the flags of a single update.
+	UpdateFlags = ProviderFlags | RecordFlags | CacheFlags | publishFlags | StateFlags
+)
+
+// Parse generates configuration of the update command from the command arguments.
 func Parse(args []string) (Configuration, error) {
-	fs := flag.NewFlagSet("cf", flag.ExitOnError)
+	return ParseCommand(Command{Name: "update", Usage: "-token xxx -domain example.com", Flags: UpdateFlags}, args)
+}
+
+// ParseCommand generates configuration from the arguments of the command, accepting only the command's flags.
+// Settings without a flag in the command keep their defaults.
+func ParseCommand(cmd Command, args []string) (Configuration, error) {
+	fs := flag.NewFlagSet(cmd.Name, flag.ExitOnError)
 	domain := ""
+	auth := AuthToken
 	token := ""
+	tokens := zoneTokens{}
+	email := ""
+	key := ""
+	baseURL := cloudflare.DefaultBaseURL
 	iface := ""
 	recordType := "A"
 	timeout := 10
 	ttl := 1
 	proxied := true
-	cache := false
+	cache := cacheFlag{}
+	cacheDir := ""
+	preflight := true
+	owner, _ := os.Hostname()
+	comment := true
+	tag := false
+	force := false
+	adopt := false
+	recordSet := false
+	provider := ProviderCloudFlare
+	nameserver := ""
+	zone := ""
+	tsigKey := ""
+	tsigSecret := ""
+	tsigAlgorithm := rfc2136.DefaultAlgorithm
+	interval := 5 * time.Minute
+	reconcile := time.Duration(0)
+	listName := ""
+	listType := ""
+	format := "table"
+	file := "-"
+	restore := false
+	all := false
+	since := ""
+	until := ""
 
 	fs.Usage = func() {
-		_, _ = fmt.Fprintf(fs.Output(), "USAGE:\n\t%s -token xxx -domain example.com\n\nCONFIGURATION:\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "USAGE:\n\t%s %s %s\n\nCONFIGURATION:\n", os.Args[0], cmd.Name, cmd.Usage)
 		fs.PrintDefaults()
 	}
 
-	fs.StringVar(&token, "token", "", "A CloudFlare token with Zone.Zone (Read), Zone.DNS (Edit) permissions (Required)")
-	fs.StringVar(&domain, "domain", "", "The domain you would like to update (Required)")
-	fs.StringVar(&recordType, "type", "A", "The record type you would like to update, must be A or AAAA")
-	fs.StringVar(&iface, "interface", "", "Get global unicast address from given interface name instead of the Internet")
-	fs.IntVar(&timeout, "timeout", 10, "API request timeout to CloudFlare and external IP service")
-	fs.IntVar(&ttl, "ttl", 1, "TTL for the domain record")
-	fs.BoolVar(&proxied, "proxied", true, "Is the request proxied through CloudFlare's servers")
-	fs.BoolVar(&cache, "cache", false, "Should the CloudFlare result be cached on disk")
+	if cmd.Flags&ProviderFlags != 0 {
+		fs.StringVar(&provider, "provider", ProviderCloudFlare, "DNS backend to publish the record to, 'cloudflare' or 'rfc2136' for dynamic updates to a name server")
+		fs.StringVar(&auth, "auth", AuthToken, "Authentication method, 'token' for API tokens or 'key' for the Global API Key")
+		fs.StringVar(&token, "token", "", "A CloudFlare token with Zone.Zone (Read), Zone.DNS (Edit) permissions (Required with -auth token, unless a -zone-token covers the domain)")
+		fs.Var(&tokens, "zone-token", "A CloudFlare token for a single zone as zone=token, can be repeated and takes precedence over -token")
+		fs.StringVar(&email, "email", "", "The CloudFlare account email (Required with -auth key)")
+		fs.StringVar(&key, "key", "", "The CloudFlare Global API Key (Required with -auth key)")
+		fs.StringVar(&baseURL, "api-url", cloudflare.DefaultBaseURL, "The URL of CloudFlare's API, for routing through a proxy or using a mock")
+		fs.IntVar(&timeout, "timeout", 10, "API request timeout to CloudFlare and external IP service")
+		fs.StringVar(&nameserver, "nameserver", "", "Authoritative name server accepting dynamic updates as host[:port] (Required with -provider rfc2136)")
+		fs.StringVar(&zone, "zone", "", "Zone of the records, the last two labels of the domain or name by default")
+		fs.StringVar(&tsigKey, "tsig-key", "", "Name of the TSIG key signing dynamic updates")
+		fs.StringVar(&tsigSecret, "tsig-secret", "", "Base64 encoded secret of the TSIG key (Required with -tsig-key)")
+		fs.StringVar(&tsigAlgorithm, "tsig-algorithm", rfc2136.DefaultAlgorithm, "Algorithm of the TSIG key, such as hmac-sha256 or hmac-sha512")
+	}
+
+	if cmd.Flags&RecordFlags != 0 {
+		fs.StringVar(&domain, "domain", "", "The domain you would like to update (Required)")
+		fs.StringVar(&recordType, "type", "A", "The record type you would like to update, must be A or AAAA")
+	}
+
+	if cmd.Flags&CacheFlags != 0 {
+		fs.Var(&cache, "cache", "Should the CloudFlare result be cached on disk, or a cache URL as -cache=bolt:///path/cache.db or -cache=redis://:password@host:6379/0")
+	}
+
+	if cmd.Flags&StateFlags != 0 {
+		fs.StringVar(&cacheDir, "cache-dir", "", "Directory of the cache, journal and history, $CACHE_DIRECTORY, $STATE_DIRECTORY or the user's cache directory by default")
+	}
+
+	if cmd.Flags&publishFlags != 0 {
+		fs.StringVar(&iface, "interface", "", "Get global unicast address from given interface name instead of the Internet")
+		fs.IntVar(&ttl, "ttl", 1, "TTL for the domain record")
+		fs.BoolVar(&proxied, "proxied", true, "Is the request proxied through CloudFlare's servers")
+		fs.BoolVar(&preflight, "preflight", true, "Verify the token and its permissions once before the first update")
+		fs.StringVar(&owner, "owner", owner, "Name identifying this host in record comments and ownership tags")
+		fs.BoolVar(&comment, "comment", true, "Stamp updated records with a comment naming the owner and update time")
+		fs.BoolVar(&tag, "tag", false, "Mark updated records with an ownership tag, not available on all CloudFlare plans")
+		fs.BoolVar(&force, "force", false, "Update the record even if its ownership marker names another owner")
+		fs.BoolVar(&adopt, "adopt", false, "Update the record even if it has no ownership marker, taking it over")
+		fs.BoolVar(&recordSet, "record-set", false, "Manage this host's entry among several records sharing the name, instead of requiring a single record")
+		fs.DurationVar(&reconcile, "reconcile", reconcile, "How long a cached record is trusted before it is read again to correct changes made outside of cloudflare-ddns, 0 to always trust it")
+	}
+
+	if cmd.Flags&DaemonFlags != 0 {
+		fs.DurationVar(&interval, "interval", interval, "How often the daemon checks the IP and updates the record")
+	}
+
+	if cmd.Flags&ListFlags != 0 {
+		fs.StringVar(&listName, "name", "", "Only list records with this name")
+		fs.StringVar(&listType, "type", "", "Only list records of this type, such as A or MX")
+		fs.StringVar(&format, "format", format, "Output format, 'table', 'json' or 'bind' for a zone file")
+	}
+
+	if cmd.Flags&SnapshotFlags != 0 {
+		format = "json"
+		fs.StringVar(&file, "file", file, "Snapshot file, '-' for standard output when exporting or standard input when importing")
+		fs.StringVar(&format, "format", format, "Snapshot format, 'json' or 'bind' for a zone file")
+		fs.BoolVar(&restore, "restore", false, "Change the zone to match the snapshot, instead of only showing the changes")
+	}
+
+	if cmd.Flags&UndoFlags != 0 {
+		fs.BoolVar(&all, "all", false, "Undo the last update of every record in the journal, instead of only the -domain record")
+		fs.BoolVar(&force, "force", false, "Restore records even if they were changed since their last journaled update")
+	}
+
+	if cmd.Flags&HistoryFlags != 0 {
+		fs.StringVar(&domain, "domain", "", "Only show events of this domain")
+		fs.StringVar(&recordType, "type", "", "Only show events of this record type, A or AAAA")
+		fs.StringVar(&since, "since", "", "Only show events since this time, as RFC 3339, a date such as 2026-09-01 or a duration before now such as 720h")
+		fs.StringVar(&until, "until", "", "Only show events before this time, in the same formats as -since")
+	}
 
-	if len(args) == 0 {
+	// Every flag of the history command is optional, so it shows all events without any.
+	if len(args) == 0 && cmd.Flags&HistoryFlags == 0 {
 		fs.Usage()
 		return Configuration{}, fmt.Errorf("no arguments provided")
 	}
@@ -68,17 +293,108 @@ func Parse(args []string) (Configuration, error) {
 		return Configuration{}, fmt.Errorf("could not parse command parameters: %w", err)
 	}
 
+	if fs.NArg() > 0 {
+		return Configuration{}, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	// Zone tokens are looked up by the zone of the record, or of the listed records.
+	target := domain
+	if target == "" && zone != "" {
+		target = zone
+	} else if target == "" {
+		target = listName
+	}
+
 	var errs []string
-	if token == "" {
-		errs = append(errs, "-token is required and must not be empty")
+	if cmd.Flags&ProviderFlags != 0 {
+		switch provider {
+		case ProviderCloudFlare:
+			errs = append(errs, validateAuth(auth, token, tokens, email, key, target)...)
+		case ProviderRFC2136:
+			errs = append(errs, validateRFC2136(nameserver, tsigKey, tsigSecret, tsigAlgorithm)...)
+		default:
+			errs = append(errs, "-provider must be 'cloudflare' or 'rfc2136'")
+		}
+
+		if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "-api-url must be an absolute http or https URL")
+		}
 	}
 
-	if domain == "" {
-		errs = append(errs, "-domain is required and must not be empty")
+	if cmd.Flags&RecordFlags != 0 {
+		if domain == "" && !all {
+			errs = append(errs, "-domain is required and must not be empty")
+		}
+
+		if domain != "" && all {
+			errs = append(errs, "-domain and -all cannot be combined")
+		}
+
+		if recordType != "A" && recordType != "AAAA" {
+			errs = append(errs, "-type must be 'A' for IPv4 or 'AAAA' for IPv6")
+		}
+	}
+
+	if cmd.Flags&publishFlags != 0 {
+		if owner == "" && (comment || tag) {
+			errs = append(errs, "-owner must not be empty when -comment or -tag is used")
+		}
+
+		if !comment && !tag {
+			errs = append(errs, "-comment or -tag must be enabled to mark records as managed")
+		}
+
+		if tag && provider == ProviderRFC2136 {
+			errs = append(errs, "-tag is not supported with -provider rfc2136, records are marked with -comment")
+		}
+	}
+
+	if cmd.Flags&ListFlags != 0 {
+		if zone == "" && listName == "" {
+			errs = append(errs, "-zone or -name is required to select the zone")
+		}
+
+		if format != "table" && format != "json" && format != "bind" {
+			errs = append(errs, "-format must be 'table', 'json' or 'bind'")
+		}
+	}
+
+	if cmd.Flags&SnapshotFlags != 0 {
+		if zone == "" {
+			errs = append(errs, "-zone is required and must not be empty")
+		}
+
+		if file == "" {
+			errs = append(errs, "-file must not be empty, use '-' for standard output or input")
+		}
+
+		if format != "json" && format != "bind" {
+			errs = append(errs, "-format must be 'json' or 'bind'")
+		}
+	}
+
+	var history History
+	if cmd.Flags&HistoryFlags != 0 {
+		var err error
+		now := time.Now()
+		if history.Since, err = parseTime(since, now); err != nil {
+			errs = append(errs, fmt.Sprintf("-since %s", err))
+		}
+		if history.Until, err = parseTime(until, now); err != nil {
+			errs = append(errs, fmt.Sprintf("-until %s", err))
+		}
+
+		if recordType != "" && recordType != "A" && recordType != "AAAA" {
+			errs = append(errs, "-type must be 'A' for IPv4 or 'AAAA' for IPv6")
+		}
 	}
 
-	if recordType != "A" && recordType != "AAAA" {
-		errs = append(errs, "-type must be 'A' for IPv4 or 'AAAA' for IPv6")
+	if cmd.Flags&publishFlags != 0 && reconcile < 0 {
+		errs = append(errs, "-reconcile must not be negative")
+	}
+
+	if cmd.Flags&DaemonFlags != 0 && interval < time.Second {
+		errs = append(errs, "-interval must be at least one second")
 	}
 
 	ipVer := ip.V4
@@ -98,18 +414,202 @@ func Parse(args []string) (Configuration, error) {
 		return Configuration{}, fmt.Errorf(strings.Join(errs, "; "))
 	}
 
-	return Configuration{
+	var dynamic RFC2136
+	if provider == ProviderRFC2136 {
+		dynamic = RFC2136{
+			Nameserver:    nameserver,
+			Zone:          zone,
+			TSIGKey:       tsigKey,
+			TSIGSecret:    tsigSecret,
+			TSIGAlgorithm: tsigAlgorithm,
+		}
+
+		// Name servers neither proxy records nor know CloudFlare's automatic TTL.
+		proxied = false
+		if ttl == 1 {
+			ttl = rfc2136.DefaultTTL
+		}
+	}
+
+	cfg := Configuration{
+		RFC2136: dynamic,
 		App: App{
+			Provider:     provider,
 			Interface:    iface,
-			CacheEnabled: cache,
+			CacheEnabled: cache.enabled,
+			CacheURL:     cache.url,
+			CacheDir:     cacheDir,
+			Preflight:    preflight,
 		},
 		CloudFlare: CloudFlare{
-			Domain:    domain,
-			Token:     token,
-			Type:      recordType,
-			Timeout:   time.Second * time.Duration(timeout),
-			Proxied:   proxied,
-			TTL:       ttl,
-			IPVersion: ipVer,
-		}}, nil
+			Domain:     domain,
+			Auth:       auth,
+			Token:      token,
+			ZoneTokens: tokens.value(),
+			Email:      email,
+			Key:        key,
+			BaseURL:    baseURL,
+			Type:       recordType,
+			Timeout:    time.Second * time.Duration(timeout),
+			Proxied:    proxied,
+			TTL:        ttl,
+			IPVersion:  ipVer,
+			Owner:      owner,
+			Comment:    comment,
+			Tag:        tag,
+			Force:      force,
+			Adopt:      adopt,
+			RecordSet:  recordSet,
+		}}
+	if cmd.Flags&publishFlags != 0 {
+		cfg.App.Reconcile = reconcile
+	}
+	if cmd.Flags&DaemonFlags != 0 {
+		cfg.App.Interval = interval
+	}
+	if cmd.Flags&ListFlags != 0 {
+		if zone == "" {
+			zone = cloudflare.ZoneName(listName)
+		}
+		cfg.List = List{Zone: zone, Name: listName, Type: strings.ToUpper(listType), Format: format}
+	}
+	if cmd.Flags&HistoryFlags != 0 {
+		history.Domain, history.Type = domain, recordType
+		cfg.History = history
+	}
+	if cmd.Flags&UndoFlags != 0 {
+		cfg.Undo = Undo{All: all, Force: force}
+	}
+	if cmd.Flags&SnapshotFlags != 0 {
+		cfg.Snapshot = Snapshot{Zone: zone, File: file, Format: format, Restore: restore}
+	}
+
+	return cfg, nil
+}
+
+// validateAuth checks the CloudFlare credentials for the authentication strategy.
+func validateAuth(auth, token string, tokens zoneTokens, email, key, domain string) []string {
+	switch auth {
+	case AuthToken:
+		if token == "" && tokens[cloudflare.ZoneName(domain)] == "" {
+			return []string{"-token is required and must not be empty, unless -zone-token is given for the domain's zone"}
+		}
+	case AuthKey:
+		if email == "" || key == "" {
+			return []string{"-email and -key are required and must not be empty with -auth key"}
+		}
+	default:
+		return []string{"-auth must be 'token' or 'key'"}
+	}
+
+	return nil
+}
+
+// validateRFC2136 checks the name server and TSIG settings of the rfc2136 provider.
+func validateRFC2136(nameserver, tsigKey, tsigSecret, tsigAlgorithm string) []string {
+	var errs []string
+	if nameserver == "" {
+		errs = append(errs, "-nameserver is required and must not be empty with -provider rfc2136")
+	}
+
+	if (tsigKey == "") != (tsigSecret == "") {
+		errs = append(errs, "-tsig-key and -tsig-secret must be given together")
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(tsigSecret); err != nil {
+		errs = append(errs, "-tsig-secret must be base64 encoded")
+	}
+
+	switch tsigAlgorithm {
+	case "hmac-md5.sig-alg.reg.int", "hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384", "hmac-sha512":
+	default:
+		errs = append(errs, "-tsig-algorithm must be one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384, hmac-sha512 or hmac-md5.sig-alg.reg.int")
+	}
+
+	return errs
+}
+
+// parseTime parses the time of an event as RFC 3339, a date in local time or a duration before now.
+// Empty values are the zero time.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("must be a time such as 2026-09-01T12:00:00Z, a date or a duration, got %q", value)
+}
+
+// String returns the zone tokens in the format of the flag, with the tokens redacted.
+func (z *zoneTokens) String() string {
+	if z == nil {
+		return ""
+	}
+
+	var zones []string
+	for zone := range *z {
+		zones = append(zones, fmt.Sprintf("%s=***", zone))
+	}
+
+	return strings.Join(zones, ",")
+}
+
+// Set adds a zone token given as zone=token.
+func (z *zoneTokens) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("zone token must be given as zone=token")
+	}
+
+	(*z)[parts[0]] = parts[1]
+	return nil
+}
+
+// String returns the cache URL, or whether the cache is enabled.
+func (c *cacheFlag) String() string {
+	if c == nil || c.url == "" {
+		return strconv.FormatBool(c != nil && c.enabled)
+	}
+
+	return c.url
+}
+
+// Set enables or disables the cache given a boolean, or selects the backend given its URL.
+func (c *cacheFlag) Set(value string) error {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		*c = cacheFlag{enabled: enabled}
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "file" && u.Scheme != "bolt" && u.Scheme != "bbolt" && u.Scheme != "redis") {
+		return fmt.Errorf("cache must be true, false or a file, bolt or redis URL")
+	}
+
+	*c = cacheFlag{enabled: true, url: value}
+	return nil
+}
+
+// IsBoolFlag makes -cache alone enable the cache, other values must be given as -cache=value.
+func (c *cacheFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (z zoneTokens) value() map[string]string {
+	if len(z) == 0 {
+		return nil
+	}
+
+	return z
 }
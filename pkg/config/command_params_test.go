@@ -1,7 +1,9 @@
 package config
 
 import (
+	"cloudflare-ddns/pkg/cloudflare"
 	"cloudflare-ddns/pkg/ip"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -9,6 +11,7 @@ import (
 )
 
 func TestFromEnvironment(t *testing.T) {
+	hostname, _ := os.Hostname()
 	tests := []struct {
 		name        string
 		args        []string
@@ -25,12 +28,20 @@ func TestFromEnvironment(t *testing.T) {
 			want: Configuration{
 				CloudFlare: CloudFlare{
 					Domain:    "nenad.dev",
+					Auth:      "token",
+					BaseURL:   cloudflare.DefaultBaseURL,
 					Token:     "token",
 					Type:      "A",
 					Timeout:   time.Second * time.Duration(10),
 					Proxied:   true,
 					TTL:       1,
 					IPVersion: ip.V4,
+					Owner:     hostname,
+					Comment:   true,
+				},
+				App: App{
+					Provider:  ProviderCloudFlare,
+					Preflight: true,
 				},
 			},
 		},
@@ -45,23 +56,132 @@ func TestFromEnvironment(t *testing.T) {
 				"-ttl", "300",
 				"-interface", "wlp3s0",
 				"-cache",
+				"-preflight=false",
+				"-api-url", "http://localhost:8080/client/v4",
+				"-owner", "router",
+				"-comment",
+				"-tag",
+				"-force",
+				"-adopt",
+				"-record-set",
+				"-reconcile", "30m",
+				"-zone-token", "nenad.dev=zone-token",
+				"-zone-token", "hello.dev=other-token",
 			},
 			want: Configuration{
 				CloudFlare: CloudFlare{
-					Domain:    "nenad.dev",
-					Token:     "token",
+					Domain:  "nenad.dev",
+					Auth:    "token",
+					BaseURL: "http://localhost:8080/client/v4",
+					Token:   "token",
+					ZoneTokens: map[string]string{
+						"nenad.dev": "zone-token",
+						"hello.dev": "other-token",
+					},
 					Type:      "AAAA",
 					Timeout:   time.Second * time.Duration(200),
 					Proxied:   true,
 					TTL:       300,
 					IPVersion: ip.V6,
+					Owner:     "router",
+					Comment:   true,
+					Tag:       true,
+					Force:     true,
+					Adopt:     true,
+					RecordSet: true,
 				},
 				App: App{
+					Provider:     ProviderCloudFlare,
 					Interface:    "wlp3s0",
 					CacheEnabled: true,
+					Reconcile:    30 * time.Minute,
+				},
+			},
+		},
+		{
+			name: "zone token alone is enough for the domain's zone",
+			args: []string{
+				"-domain", "home.nenad.dev",
+				"-zone-token", "nenad.dev=zone-token",
+			},
+			want: Configuration{
+				CloudFlare: CloudFlare{
+					Domain:     "home.nenad.dev",
+					Auth:       "token",
+					BaseURL:    cloudflare.DefaultBaseURL,
+					ZoneTokens: map[string]string{"nenad.dev": "zone-token"},
+					Type:       "A",
+					Timeout:    time.Second * time.Duration(10),
+					Proxied:    true,
+					TTL:        1,
+					IPVersion:  ip.V4,
+					Owner:      hostname,
+					Comment:    true,
+				},
+				App: App{
+					Provider:  ProviderCloudFlare,
+					Preflight: true,
 				},
 			},
 		},
+		{
+			name: "zone token for another zone is not enough",
+			args: []string{
+				"-domain", "home.nenad.dev",
+				"-zone-token", "hello.dev=zone-token",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-token", "-zone-token"},
+		},
+		{
+			name: "global key authentication requires email and key",
+			args: []string{
+				"-domain", "nenad.dev",
+				"-auth", "key",
+				"-key", "key",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-email", "-key"},
+		},
+		{
+			name: "global key authentication does not require a token",
+			args: []string{
+				"-domain", "nenad.dev",
+				"-auth", "key",
+				"-email", "me@nenad.dev",
+				"-key", "key",
+			},
+			want: Configuration{
+				CloudFlare: CloudFlare{
+					Domain:    "nenad.dev",
+					Auth:      "key",
+					BaseURL:   cloudflare.DefaultBaseURL,
+					Email:     "me@nenad.dev",
+					Key:       "key",
+					Type:      "A",
+					Timeout:   time.Second * time.Duration(10),
+					Proxied:   true,
+					TTL:       1,
+					IPVersion: ip.V4,
+					Owner:     hostname,
+					Comment:   true,
+				},
+				App: App{
+					Provider:  ProviderCloudFlare,
+					Preflight: true,
+				},
+			},
+		},
+		{
+			name: "API URL must be absolute",
+			args: []string{
+				"-domain", "nenad.dev",
+				"-token", "token",
+				"-api-url", "localhost:8080",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-api-url"},
+		},
 		{
 			name: "type is only A or AAAA",
 			args: []string{
@@ -72,6 +192,95 @@ func TestFromEnvironment(t *testing.T) {
 			want:        Configuration{},
 			errKeywords: []string{"-type", "AAAA"},
 		},
+		{
+			name: "empty owner is rejected when records are stamped",
+			args: []string{
+				"-domain", "nenad.dev",
+				"-token", "token",
+				"-owner", "",
+				"-comment",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-owner"},
+		},
+		{
+			name: "records must be marked either by comment or by tag",
+			args: []string{
+				"-domain", "nenad.dev",
+				"-token", "token",
+				"-comment=false",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-comment", "-tag"},
+		},
+		{
+			name: "rfc2136 provider does not require CloudFlare credentials",
+			args: []string{
+				"-provider", "rfc2136",
+				"-domain", "home.nenad.lan",
+				"-nameserver", "10.0.0.53",
+				"-zone", "nenad.lan",
+				"-tsig-key", "ddns-key",
+				"-tsig-secret", "c2VjcmV0",
+				"-tsig-algorithm", "hmac-sha512",
+			},
+			want: Configuration{
+				CloudFlare: CloudFlare{
+					Domain:    "home.nenad.lan",
+					Auth:      "token",
+					BaseURL:   cloudflare.DefaultBaseURL,
+					Type:      "A",
+					Timeout:   time.Second * time.Duration(10),
+					TTL:       300,
+					IPVersion: ip.V4,
+					Owner:     hostname,
+					Comment:   true,
+				},
+				RFC2136: RFC2136{
+					Nameserver:    "10.0.0.53",
+					Zone:          "nenad.lan",
+					TSIGKey:       "ddns-key",
+					TSIGSecret:    "c2VjcmV0",
+					TSIGAlgorithm: "hmac-sha512",
+				},
+				App: App{
+					Provider:  ProviderRFC2136,
+					Preflight: true,
+				},
+			},
+		},
+		{
+			name: "rfc2136 provider requires a name server and a complete TSIG key",
+			args: []string{
+				"-provider", "rfc2136",
+				"-domain", "home.nenad.lan",
+				"-tsig-key", "ddns-key",
+				"-tag",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-nameserver", "-tsig-secret", "-tag"},
+		},
+		{
+			name: "rfc2136 provider rejects secrets that are not base64",
+			args: []string{
+				"-provider", "rfc2136",
+				"-domain", "home.nenad.lan",
+				"-nameserver", "10.0.0.53",
+				"-tsig-key", "ddns-key",
+				"-tsig-secret", "not base64!",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-tsig-secret", "base64"},
+		},
+		{
+			name: "unknown provider",
+			args: []string{
+				"-provider", "route53",
+				"-domain", "nenad.dev",
+			},
+			want:        Configuration{},
+			errKeywords: []string{"-provider"},
+		},
 		{
 			name:        "empty command line should fail with no arguments provided",
 			args:        []string{},
@@ -102,3 +311,277 @@ func TestFromEnvironment(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCommand(t *testing.T) {
+	hostname, _ := os.Hostname()
+	defaults := CloudFlare{
+		Domain:    "nenad.dev",
+		Auth:      "token",
+		BaseURL:   cloudflare.DefaultBaseURL,
+		Token:     "token",
+		Type:      "A",
+		Timeout:   time.Second * time.Duration(10),
+		Proxied:   true,
+		TTL:       1,
+		IPVersion: ip.V4,
+		Owner:     hostname,
+		Comment:   true,
+	}
+
+	tests := []struct {
+		name        string
+		cmd         Command
+		args        []string
+		want        Configuration
+		errKeywords []string
+	}{
+		{
+			name: "daemon has an interval",
+			cmd:  Command{Name: "run", Flags: UpdateFlags | DaemonFlags},
+			args: []string{"-domain", "nenad.dev", "-token", "token", "-interval", "1m"},
+			want: Configuration{
+				CloudFlare: defaults,
+				App:        App{Provider: ProviderCloudFlare, Preflight: true, Interval: time.Minute},
+			},
+		},
+		{
+			name:        "daemon interval must be positive",
+			cmd:         Command{Name: "run", Flags: UpdateFlags | DaemonFlags},
+			args:        []string{"-domain", "nenad.dev", "-token", "token", "-interval", "0s"},
+			errKeywords: []string{"-interval"},
+		},
+		{
+			name:        "reconcile interval must not be negative",
+			cmd:         Command{Name: "update", Flags: UpdateFlags},
+			args:        []string{"-domain", "nenad.dev", "-token", "token", "-reconcile", "-1h"},
+			errKeywords: []string{"-reconcile"},
+		},
+		{
+			name: "flags of other commands are not validated",
+			cmd:  Command{Name: "verify", Flags: ProviderFlags | RecordFlags},
+			args: []string{"-domain", "nenad.dev", "-token", "token"},
+			want: Configuration{
+				CloudFlare: defaults,
+				App:        App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name: "commands without provider flags need no credentials",
+			cmd:  Command{Name: "cache show", Flags: RecordFlags},
+			args: []string{"-domain", "nenad.dev", "-type", "AAAA"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Token, c.Type, c.IPVersion = "", "AAAA", ip.V6
+					return c
+				}(),
+				App: App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name: "list selects the zone by the name of the records",
+			cmd:  Command{Name: "list", Flags: ProviderFlags | ListFlags},
+			args: []string{"-zone-token", "nenad.dev=zone-token", "-name", "home.nenad.dev", "-type", "aaaa", "-format", "bind"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Domain, c.Token, c.ZoneTokens = "", "", map[string]string{"nenad.dev": "zone-token"}
+					return c
+				}(),
+				List: List{Zone: "nenad.dev", Name: "home.nenad.dev", Type: "AAAA", Format: "bind"},
+				App:  App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name:        "list requires a zone and a known format",
+			cmd:         Command{Name: "list", Flags: ProviderFlags | ListFlags},
+			args:        []string{"-token", "token", "-format", "yaml"},
+			errKeywords: []string{"-zone", "-format"},
+		},
+		{
+			name: "import reads a snapshot of the zone",
+			cmd:  Command{Name: "import", Flags: ProviderFlags | SnapshotFlags},
+			args: []string{"-token", "token", "-zone", "nenad.dev", "-file", "nenad.dev.zone", "-format", "bind", "-restore"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Domain = ""
+					return c
+				}(),
+				Snapshot: Snapshot{Zone: "nenad.dev", File: "nenad.dev.zone", Format: "bind", Restore: true},
+				App:      App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name: "export writes JSON to standard output by default",
+			cmd:  Command{Name: "export", Flags: ProviderFlags | SnapshotFlags},
+			args: []string{"-token", "token", "-zone", "nenad.dev"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Domain = ""
+					return c
+				}(),
+				Snapshot: Snapshot{Zone: "nenad.dev", File: "-", Format: "json"},
+				App:      App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name:        "snapshots require a zone and a zone file format",
+			cmd:         Command{Name: "export", Flags: ProviderFlags | SnapshotFlags},
+			args:        []string{"-token", "token", "-format", "table"},
+			errKeywords: []string{"-zone", "-format"},
+		},
+		{
+			name: "undo selects every journaled record",
+			cmd:  Command{Name: "undo", Flags: ProviderFlags | RecordFlags | UndoFlags},
+			args: []string{"-token", "token", "-all"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Domain = ""
+					return c
+				}(),
+				Undo: Undo{All: true},
+				App:  App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name:        "undo selects either a domain or every record",
+			cmd:         Command{Name: "undo", Flags: ProviderFlags | RecordFlags | UndoFlags},
+			args:        []string{"-token", "token", "-domain", "nenad.dev", "-all"},
+			errKeywords: []string{"-domain and -all"},
+		},
+		{
+			name: "history selects events by domain and time range",
+			cmd:  Command{Name: "history", Flags: HistoryFlags},
+			args: []string{"-domain", "home.nenad.dev", "-since", "2026-09-01T00:00:00Z", "-until", "2026-10-01T00:00:00Z"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Domain, c.Token, c.Type = "home.nenad.dev", "", ""
+					return c
+				}(),
+				History: History{
+					Domain: "home.nenad.dev",
+					Since:  time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+					Until:  time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+				},
+				App: App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name:        "history requires valid times",
+			cmd:         Command{Name: "history", Flags: HistoryFlags},
+			args:        []string{"-since", "last month"},
+			errKeywords: []string{"-since", "last month"},
+		},
+		{
+			name: "cache directory is configurable",
+			cmd:  Command{Name: "cache show", Flags: RecordFlags | StateFlags},
+			args: []string{"-domain", "nenad.dev", "-cache-dir", "/var/cache/cloudflare-ddns"},
+			want: Configuration{
+				CloudFlare: func() CloudFlare {
+					c := defaults
+					c.Token = ""
+					return c
+				}(),
+				App: App{Provider: ProviderCloudFlare, Preflight: true, CacheDir: "/var/cache/cloudflare-ddns"},
+			},
+		},
+		{
+			name: "cache backend is selected by URL",
+			cmd:  Command{Name: "update", Flags: UpdateFlags},
+			args: []string{"-domain", "nenad.dev", "-token", "token", "-cache=redis://:secret@localhost:6379/1"},
+			want: Configuration{
+				CloudFlare: defaults,
+				App:        App{Provider: ProviderCloudFlare, Preflight: true, CacheEnabled: true, CacheURL: "redis://:secret@localhost:6379/1"},
+			},
+		},
+		{
+			name: "cache can be disabled explicitly",
+			cmd:  Command{Name: "update", Flags: UpdateFlags},
+			args: []string{"-domain", "nenad.dev", "-token", "token", "-cache=false"},
+			want: Configuration{
+				CloudFlare: defaults,
+				App:        App{Provider: ProviderCloudFlare, Preflight: true},
+			},
+		},
+		{
+			name:        "positional arguments are rejected",
+			cmd:         Command{Name: "verify", Flags: ProviderFlags | RecordFlags},
+			args:        []string{"-domain", "nenad.dev", "-token", "token", "extra"},
+			errKeywords: []string{"unexpected arguments", "extra"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCommand(tt.cmd, tt.args)
+
+			if err != nil && len(tt.errKeywords) == 0 {
+				t.Fatalf("got error when none was expected: %s", err)
+			} else if err != nil {
+				for _, kw := range tt.errKeywords {
+					if !strings.Contains(err.Error(), kw) {
+						t.Fatalf("expected error to contain keyword %q, got %q", kw, err)
+					}
+				}
+			} else if len(tt.errKeywords) > 0 {
+				t.Fatalf("no error expected, got %q", tt.errKeywords)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCommand() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "", want: time.Time{}},
+		{value: "2026-09-01T08:00:00+02:00", want: time.Date(2026, 9, 1, 6, 0, 0, 0, time.UTC)},
+		{value: "2026-09-01", want: time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)},
+		{value: "720h", want: now.Add(-720 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTime(tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %s (%v), want %s", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestCacheFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    cacheFlag
+		wantErr bool
+	}{
+		{value: "true", want: cacheFlag{enabled: true}},
+		{value: "false", want: cacheFlag{}},
+		{value: "bolt:///var/cache/cloudflare-ddns/cache.db", want: cacheFlag{enabled: true, url: "bolt:///var/cache/cloudflare-ddns/cache.db"}},
+		{value: "redis://localhost", want: cacheFlag{enabled: true, url: "redis://localhost"}},
+		{value: "memcached://localhost", wantErr: true},
+		{value: "yes please", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got := cacheFlag{}
+		if err := got.Set(tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+		} else if !tt.wantErr && got != tt.want {
+			t.Errorf("Set(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+
+	if !(&cacheFlag{}).IsBoolFlag() {
+		t.Errorf("expected -cache to be usable without a value")
+	}
+}
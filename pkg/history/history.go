@@ -0,0 +1,205 @@
+package history
+
+import (
+	"bufio"
+	"cloudflare-ddns/pkg/cloudflare"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// DefaultMaxSize is the size in bytes at which the history file is rotated.
+	DefaultMaxSize = 1 << 20
+	// DefaultKeep is the number of rotated history files that are kept.
+	DefaultKeep = 10
+
+	filename = "history.jsonl"
+)
+
+type (
+	// Event is the outcome of checking the IP and updating a record once.
+	Event struct {
+		Time     time.Time       `json:"time"`
+		Domain   string          `json:"domain"`
+		Type     cloudflare.Type `json:"type"`
+		IP       string          `json:"ip,omitempty"`       // IP observed, empty if it could not be retrieved.
+		Previous string          `json:"previous,omitempty"` // Previous content of the record, if it was known.
+		Action   string          `json:"action"`
+		Error    string          `json:"error,omitempty"`
+	}
+
+	// Query selects events of a record within a time range. Empty fields match every event.
+	Query struct {
+		Domain string
+		Type   cloudflare.Type
+		Since  time.Time
+		Until  time.Time
+	}
+
+	// Store keeps events in a JSONL file, rotating it once it grows too large.
+	// Rotated files are numbered from the most recent, as history.jsonl.1, history.jsonl.2 and so on.
+	Store struct {
+		dir     string
+		maxSize int64
+		keep    int
+	}
+)
+
+// MaxSize sets the size in bytes at which the history file is rotated.
+func MaxSize(size int64) func(*Store) {
+	return func(s *Store) {
+		s.maxSize = size
+	}
+}
+
+// Keep sets the number of rotated history files that are kept, older ones are removed.
+func Keep(files int) func(*Store) {
+	return func(s *Store) {
+		s.keep = files
+	}
+}
+
+// New returns a store keeping the history in the directory.
+func New(dir string, options ...func(*Store)) *Store {
+	s := &Store{dir: dir, maxSize: DefaultMaxSize, keep: DefaultKeep}
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
+}
+
+// Append adds the event to the history, rotating the file first if the event would not fit.
+func (s *Store) Append(e Event) (err error) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not encode event: %w", err)
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("could not create history directory: %w", err)
+	}
+
+	if info, err := os.Stat(s.file(0)); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("could not rotate history: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(s.file(0), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open history: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("could not write history: %w", closeErr)
+		}
+	}()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("could not write history: %w", err)
+	}
+
+	return nil
+}
+
+// Events returns the events matching the query, oldest first.
+func (s *Store) Events(q Query) ([]Event, error) {
+	var events []Event
+	for i := s.keep; i >= 0; i-- {
+		found, err := readEvents(s.file(i), q)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, found...)
+	}
+
+	return events, nil
+}
+
+// rotate shifts every history file to the next number, removing the oldest one.
+func (s *Store) rotate() error {
+	if err := os.Remove(s.file(s.keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := s.keep - 1; i >= 0; i-- {
+		if err := os.Rename(s.file(i), s.file(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// file returns the path of the history file with the number, 0 being the current one.
+func (s *Store) file(i int) string {
+	if i == 0 {
+		return path.Join(s.dir, filename)
+	}
+
+	return path.Join(s.dir, fmt.Sprintf("%s.%d", filename, i))
+}
+
+func readEvents(file string, q Query) ([]Event, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open history: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("could not read event on line %d of %s: %w", line, file, err)
+		}
+		if q.Matches(e) {
+			events = append(events, e)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+
+	return events, nil
+}
+
+// Matches reports whether the event is of the queried record and within the time range.
+func (q Query) Matches(e Event) bool {
+	return (q.Domain == "" || strings.EqualFold(strings.TrimSuffix(q.Domain, "."), e.Domain)) &&
+		(q.Type == "" || q.Type == e.Type) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
+
+// Write writes the events as an aligned table for reading.
+func Write(w io.Writer, events []Event) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TIME\tDOMAIN\tTYPE\tACTION\tIP\tDETAILS")
+	for _, e := range events {
+		details := e.Error
+		if details == "" && e.Previous != "" && e.Previous != e.IP {
+			details = "from " + e.Previous
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Domain, e.Type, e.Action, e.IP, details)
+	}
+
+	return tw.Flush()
+}
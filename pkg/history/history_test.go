@@ -0,0 +1,133 @@
+package history_test
+
+import (
+	"bytes"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/history"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	return dir
+}
+
+func TestStore_Events(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	var events []history.Event
+	for i := 0; i < 20; i++ {
+		events = append(events, history.Event{
+			Time:   start.Add(time.Duration(i) * 24 * time.Hour),
+			Domain: []string{"home.nenad.dev", "office.nenad.dev"}[i%2],
+			Type:   cloudflare.A,
+			IP:     fmt.Sprintf("192.168.0.%d", i),
+			Action: "updated",
+		})
+	}
+
+	s := history.New(tempDir(t))
+	for _, e := range events {
+		if err := s.Append(e); err != nil {
+			t.Fatalf("could not append event: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query history.Query
+		want  []history.Event
+	}{
+		{name: "every event", want: events},
+		{name: "events of a domain", query: history.Query{Domain: "office.nenad.dev"}, want: []history.Event{events[1], events[3], events[5], events[7], events[9], events[11], events[13], events[15], events[17], events[19]}},
+		{name: "events of another type", query: history.Query{Type: cloudflare.AAAA}},
+		{name: "events in a time range", query: history.Query{Since: events[3].Time, Until: events[6].Time}, want: events[3:6]},
+		{name: "events of a domain in a time range", query: history.Query{Domain: "home.nenad.dev", Since: events[3].Time, Until: events[6].Time}, want: []history.Event{events[4]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Events(tt.query)
+			if err != nil {
+				t.Fatalf("could not get events: %s", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want events %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStore_Rotation(t *testing.T) {
+	dir := tempDir(t)
+	s := history.New(dir, history.MaxSize(300), history.Keep(2))
+
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		e := history.Event{Time: start.Add(time.Duration(i) * time.Hour), Domain: "home.nenad.dev", Type: cloudflare.A, Action: "skipped"}
+		if err := s.Append(e); err != nil {
+			t.Fatalf("could not append event: %s", err)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+		if f.Size() > 300 {
+			t.Errorf("file %s of %d bytes exceeds the maximum size", f.Name(), f.Size())
+		}
+	}
+	if want := []string{"history.jsonl", "history.jsonl.1", "history.jsonl.2"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("want files %v, got %v", want, names)
+	}
+
+	events, err := s.Events(history.Query{})
+	if err != nil {
+		t.Fatalf("could not get events: %s", err)
+	}
+	if len(events) == 0 || len(events) >= 20 || !events[len(events)-1].Time.Equal(start.Add(19*time.Hour)) {
+		t.Fatalf("expected the oldest events to be removed, got %v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if !events[i].Time.After(events[i-1].Time) {
+			t.Fatalf("expected events in order, got %v", events)
+		}
+	}
+
+	if _, err := os.Stat(path.Join(dir, "history.jsonl.3")); !os.IsNotExist(err) {
+		t.Errorf("expected no more than two rotated files, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	events := []history.Event{
+		{Time: time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC), Domain: "home.nenad.dev", Type: cloudflare.A, IP: "192.168.0.2", Previous: "192.168.0.1", Action: "updated"},
+		{Time: time.Date(2026, 9, 1, 12, 5, 0, 0, time.UTC), Domain: "home.nenad.dev", Type: cloudflare.A, IP: "192.168.0.2", Previous: "192.168.0.2", Action: "skipped"},
+		{Time: time.Date(2026, 9, 1, 12, 10, 0, 0, time.UTC), Domain: "home.nenad.dev", Type: cloudflare.A, Action: "failed", Error: "could not get IP: timeout"},
+	}
+
+	b := &bytes.Buffer{}
+	if err := history.Write(b, events); err != nil {
+		t.Fatalf("could not write events: %s", err)
+	}
+
+	want := "TIME                  DOMAIN          TYPE  ACTION   IP           DETAILS\n" +
+		"2026-09-01T12:00:00Z  home.nenad.dev  A     updated  192.168.0.2  from 192.168.0.1\n" +
+		"2026-09-01T12:05:00Z  home.nenad.dev  A     skipped  192.168.0.2  \n" +
+		"2026-09-01T12:10:00Z  home.nenad.dev  A     failed                could not get IP: timeout\n"
+	if b.String() != want {
+		t.Errorf("want output\n%s\ngot\n%s", want, b.String())
+	}
+}
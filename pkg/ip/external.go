@@ -17,6 +17,7 @@ type (
 	// API is an HTTP client that can invoke ipify's API.
 	API struct {
 		client *http.Client
+		urls   map[Version]string
 	}
 )
 
@@ -27,6 +28,13 @@ func Client(client *http.Client) func(*API) {
 	}
 }
 
+// URL sets the URL queried for the given IP version, such as an ipify stand-in.
+func URL(version Version, url string) func(*API) {
+	return func(a *API) {
+		a.urls[version] = url
+	}
+}
+
 // Timeout sets the timeout of HTTP requests to ipify.
 func Timeout(duration time.Duration) func(*API) {
 	return func(a *API) {
@@ -45,6 +53,10 @@ func Retry(attempts int) func(*API) {
 func NewClient(options ...func(*API)) *API {
 	c := &API{
 		client: &http.Client{},
+		urls:   map[Version]string{},
+	}
+	for v, u := range ipifyUrl {
+		c.urls[v] = u
 	}
 
 	for _, o := range options {
@@ -57,7 +69,7 @@ func NewClient(options ...func(*API)) *API {
 // Get returns the queried IP version, or an error if there are issues getting it.
 func (c *API) Get(version Version) (ip string, err error) {
 	// TODO Verify the requested version and returned response
-	req, err := http.NewRequest("GET", ipifyUrl[version], nil)
+	req, err := http.NewRequest("GET", c.urls[version], nil)
 	if err != nil {
 		return "", fmt.Errorf("could not construct request: %w", err)
 	}
@@ -3,6 +3,7 @@ package ip_test
 import (
 	"cloudflare-ddns/pkg/ip"
 	"cloudflare-ddns/pkg/test"
+	"errors"
 	"net/http"
 	"testing"
 )
@@ -88,3 +89,32 @@ func Test_VersionsGet(t *testing.T) {
 		})
 	}
 }
+
+func Test_ChangingIPFromIPify(t *testing.T) {
+	seq := test.NewIPSequence(map[ip.Version][]test.IPStep{
+		ip.V4: append(test.IPs("192.168.0.1"), test.IPStep{Err: errors.New("captive portal")}, test.IPStep{IP: "192.168.0.2"}),
+		ip.V6: test.IPs("fe80::1"),
+	})
+	ipify := test.NewIPify(seq)
+	defer ipify.Close()
+
+	client := ip.NewClient(ip.URL(ip.V4, ipify.URL(ip.V4)), ip.URL(ip.V6, ipify.URL(ip.V6)))
+
+	for i, want := range []string{"192.168.0.1", "", "192.168.0.2", "192.168.0.2"} {
+		got, err := client.Get(ip.V4)
+		if (err != nil) != (want == "") {
+			t.Fatalf("call %d: unexpected error %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("call %d: want %q, got %q", i, want, got)
+		}
+	}
+
+	if got, err := client.Get(ip.V6); err != nil || got != "fe80::1" {
+		t.Fatalf("want %q, got %q with error %v", "fe80::1", got, err)
+	}
+
+	if seq.Calls(ip.V4) != 4 || seq.Calls(ip.V6) != 1 {
+		t.Fatalf("unexpected number of calls, got %d for v4 and %d for v6", seq.Calls(ip.V4), seq.Calls(ip.V6))
+	}
+}
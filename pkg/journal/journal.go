@@ -0,0 +1,174 @@
+package journal
+
+import (
+	"bufio"
+	"cloudflare-ddns/pkg/cloudflare"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// Filename is the name of the journal in the cache directory.
+const Filename = "journal.jsonl"
+
+type (
+	// Entry is a single change of the content of a record.
+	Entry struct {
+		Time     time.Time       `json:"time"`
+		ZoneID   string          `json:"zone_id,omitempty"`
+		RecordID string          `json:"record_id"`
+		Name     string          `json:"name"`
+		Type     cloudflare.Type `json:"type"`
+		TTL      int             `json:"ttl,omitempty"`
+		Old      string          `json:"old"`
+		New      string          `json:"new"`
+	}
+
+	// RecordUpdater is a DNS provider that can read and change the content of a record.
+	RecordUpdater interface {
+		GetRecord(ctx context.Context, name string, recordType cloudflare.Type) (cloudflare.Record, error)
+		UpdateRecord(ctx context.Context, rec cloudflare.Record, request cloudflare.DNSUpdateRequest) error
+	}
+
+	// recordLister is implemented by providers that can return every record of a name, such as the members of a round-robin set.
+	recordLister interface {
+		GetRecords(ctx context.Context, name string, recordType cloudflare.Type) ([]cloudflare.Record, error)
+	}
+
+	// Journal is an append-only file of record changes, one JSON entry per line.
+	Journal struct {
+		path string
+	}
+)
+
+// New returns a journal stored in the file at the path.
+func New(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Append adds the entry to the end of the journal, creating it if needed.
+func (j *Journal) Append(e Entry) (err error) {
+	if err := os.MkdirAll(path.Dir(j.path), 0700); err != nil {
+		return fmt.Errorf("could not create journal directory: %w", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open journal: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("could not write journal: %w", closeErr)
+		}
+	}()
+
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		return fmt.Errorf("could not write journal: %w", err)
+	}
+
+	return nil
+}
+
+// Entries returns every entry of the journal, oldest first. A missing journal has no entries.
+func (j *Journal) Entries() ([]Entry, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open journal: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("could not read journal entry on line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read journal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Latest returns the last entry of every record matching the filter, in the order they were journaled.
+func Latest(entries []Entry, filter cloudflare.RecordFilter) []Entry {
+	last := map[string]int{}
+	for i, e := range entries {
+		if filter.Matches(cloudflare.Record{Name: e.Name, Type: e.Type}) {
+			last[e.RecordID] = i
+		}
+	}
+
+	var latest []Entry
+	for i, e := range entries {
+		if j, ok := last[e.RecordID]; ok && i == j {
+			latest = append(latest, e)
+		}
+	}
+
+	return latest
+}
+
+// Undo restores the content the record had before the entry, and journals the change.
+// It refuses to when the record was changed since the entry, unless force is set.
+func (j *Journal) Undo(ctx context.Context, provider RecordUpdater, e Entry, force bool) error {
+	rec, err := current(ctx, provider, e)
+	if err != nil {
+		return fmt.Errorf("could not read %s record %q: %w", e.Type, e.Name, err)
+	}
+	if rec.Content != e.New && !force {
+		return fmt.Errorf("%s record %q was changed to %s since it was updated to %s, use -force to restore %s anyway", e.Type, e.Name, rec.Content, e.New, e.Old)
+	}
+
+	if err := provider.UpdateRecord(ctx, rec, cloudflare.DNSUpdateRequest{Content: e.Old}); err != nil {
+		return fmt.Errorf("could not restore %s record %q to %s: %w", e.Type, e.Name, e.Old, err)
+	}
+
+	undone := e
+	undone.Time = time.Now().UTC()
+	undone.Old, undone.New = rec.Content, e.Old
+	return j.Append(undone)
+}
+
+// current returns the live record the entry changed, matched by its ID.
+func current(ctx context.Context, provider RecordUpdater, e Entry) (cloudflare.Record, error) {
+	var recs []cloudflare.Record
+	if lister, ok := provider.(recordLister); ok {
+		var err error
+		if recs, err = lister.GetRecords(ctx, e.Name, e.Type); err != nil {
+			return cloudflare.Record{}, err
+		}
+	} else {
+		rec, err := provider.GetRecord(ctx, e.Name, e.Type)
+		if err != nil {
+			return cloudflare.Record{}, err
+		}
+		recs = append(recs, rec)
+	}
+
+	for _, rec := range recs {
+		if rec.ID == e.RecordID {
+			return rec, nil
+		}
+	}
+
+	return cloudflare.Record{}, fmt.Errorf("record %s no longer exists", e.RecordID)
+}
+
+// String describes the entry in a single line.
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %s %s changed from %s to %s", e.Time.Format(time.RFC3339), e.Name, e.Type, e.Old, e.New)
+}
@@ -0,0 +1,117 @@
+package journal_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/journal"
+	"cloudflare-ddns/pkg/test"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempJournal(t *testing.T) *journal.Journal {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	return journal.New(path.Join(dir, "cloudflare-ddns", "journal.jsonl"))
+}
+
+func TestJournal_Entries(t *testing.T) {
+	j := tempJournal(t)
+	if entries, err := j.Entries(); err != nil || entries != nil {
+		t.Fatalf("expected no entries in a missing journal, got %v (%v)", entries, err)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	want := []journal.Entry{
+		{Time: now, RecordID: "1", Name: "home.nenad.dev", Type: cloudflare.A, Old: "192.168.0.1", New: "192.168.0.2"},
+		{Time: now.Add(time.Hour), RecordID: "2", Name: "home.nenad.dev", Type: cloudflare.AAAA, Old: "::1", New: "::2"},
+		{Time: now.Add(2 * time.Hour), RecordID: "1", Name: "home.nenad.dev", Type: cloudflare.A, Old: "192.168.0.2", New: "10.0.0.1"},
+	}
+	for _, e := range want {
+		if err := j.Append(e); err != nil {
+			t.Fatalf("could not append entry: %s", err)
+		}
+	}
+
+	got, err := j.Entries()
+	if err != nil {
+		t.Fatalf("could not read entries: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want entries %v, got %v", want, got)
+	}
+
+	if latest := journal.Latest(got, cloudflare.RecordFilter{}); !reflect.DeepEqual(latest, want[1:]) {
+		t.Errorf("want the latest entry of every record, got %v", latest)
+	}
+	if latest := journal.Latest(got, cloudflare.RecordFilter{Name: "home.nenad.dev", Type: cloudflare.A}); !reflect.DeepEqual(latest, want[2:]) {
+		t.Errorf("want the latest entry of the A record, got %v", latest)
+	}
+}
+
+func TestJournal_Undo(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	rec := fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "10.0.0.1"})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	j := tempJournal(t)
+	e := journal.Entry{ZoneID: rec.ZoneID, RecordID: rec.ID, Name: rec.Name, Type: rec.Type, Old: "192.168.0.1", New: "10.0.0.1"}
+	if err := j.Undo(context.Background(), client, e, false); err != nil {
+		t.Fatalf("could not undo: %s", err)
+	}
+
+	if recs := fake.Records("nenad.dev"); len(recs) != 1 || recs[0].Content != "192.168.0.1" {
+		t.Fatalf("expected the record to be restored, got %v", recs)
+	}
+
+	entries, err := j.Entries()
+	if err != nil || len(entries) != 1 || entries[0].Old != "10.0.0.1" || entries[0].New != "192.168.0.1" {
+		t.Fatalf("expected the undo to be journaled, got %v (%v)", entries, err)
+	}
+}
+
+func TestJournal_UndoChangedRecord(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	rec := fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "10.0.0.2"})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	j := tempJournal(t)
+	e := journal.Entry{ZoneID: rec.ZoneID, RecordID: rec.ID, Name: rec.Name, Type: rec.Type, Old: "192.168.0.1", New: "10.0.0.1"}
+	if err := j.Undo(context.Background(), client, e, false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("expected the undo to be refused, got %v", err)
+	}
+	if recs := fake.Records("nenad.dev"); len(recs) != 1 || recs[0].Content != "10.0.0.2" {
+		t.Fatalf("expected the record to be kept, got %v", recs)
+	}
+
+	if err := j.Undo(context.Background(), client, e, true); err != nil {
+		t.Fatalf("could not force the undo: %s", err)
+	}
+	if recs := fake.Records("nenad.dev"); len(recs) != 1 || recs[0].Content != "192.168.0.1" {
+		t.Fatalf("expected the record to be restored, got %v", recs)
+	}
+
+	entries, err := j.Entries()
+	if err != nil || len(entries) != 1 || entries[0].Old != "10.0.0.2" {
+		t.Fatalf("expected the undo to journal the replaced content, got %v (%v)", entries, err)
+	}
+}
@@ -3,10 +3,14 @@ package resilience
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 // Retry retries the round trip until no-500 response is received, or the attempts are exhausted.
+// Rate limited responses are retried as well, waiting for as long as the Retry-After header asks to.
+// When the attempts are exhausted, the last response is returned as is so callers can inspect its status.
+// Requests with a body are only retried if the body can be read again through GetBody.
 type Retry struct {
 	NextRoundTrip http.RoundTripper
 	Wait          time.Duration
@@ -20,19 +24,71 @@ func (r *Retry) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 	if r.Wait == 0 {
 		r.Wait = time.Second
 	}
+	if r.NextRoundTrip == nil {
+		r.NextRoundTrip = http.DefaultTransport
+	}
 
 	for i := 0; i < r.Attempts; i++ {
+		if i > 0 {
+			if req, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+
 		resp, err = r.NextRoundTrip.RoundTrip(req)
 
-		if err == nil && resp.StatusCode < 500 {
+		last := i == r.Attempts-1
+		if err == nil && (last || resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests) {
+			return resp, err
+		}
+		if last {
+			break
+		}
+		// A body that cannot be read again would be sent empty, so the failure is returned as is.
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
 			return resp, err
 		}
+		if err == nil && resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+
+		wait := r.Wait
+		if err == nil {
+			if after := retryAfter(resp); after > 0 {
+				wait = after
+			}
+		}
 
 		select {
 		case <-req.Context().Done():
-			return resp, req.Context().Err()
-		case <-time.After(r.Wait):
+			return nil, req.Context().Err()
+		case <-time.After(wait):
 		}
 	}
 	return resp, fmt.Errorf("could not get a response after %d attempts: %w", r.Attempts, err)
 }
+
+// rewind returns a copy of the request with a fresh body, as the previous attempt consumed it.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("could not rewind request body: %w", err)
+	}
+
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	return retry, nil
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
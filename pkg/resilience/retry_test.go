@@ -1,10 +1,14 @@
 package resilience
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -97,3 +101,125 @@ func TestRetry_RoundTripFailsAfterAttemptsExhausted(t *testing.T) {
 	}
 
 }
+
+type statusRoundTrip struct {
+	statuses []int
+	calls    int
+	bodies   []string
+}
+
+func (t *statusRoundTrip) RoundTrip(r *http.Request) (*http.Response, error) {
+	status := t.statuses[t.calls]
+	t.calls++
+	if r.Body != nil {
+		body, _ := ioutil.ReadAll(r.Body)
+		t.bodies = append(t.bodies, string(body))
+	}
+
+	return &http.Response{StatusCode: status, Header: http.Header{"Retry-After": {"0"}}}, nil
+}
+
+func TestRetry_RoundTripRetriesStatusCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		attempts   int
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			name:       "rate limited response is retried",
+			statuses:   []int{429, 200},
+			attempts:   3,
+			wantStatus: 200,
+			wantCalls:  2,
+		},
+		{
+			name:       "client errors are not retried",
+			statuses:   []int{403},
+			attempts:   3,
+			wantStatus: 403,
+			wantCalls:  1,
+		},
+		{
+			name:       "last server error is returned after attempts are exhausted",
+			statuses:   []int{503, 502, 500},
+			attempts:   3,
+			wantStatus: 500,
+			wantCalls:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &statusRoundTrip{statuses: tt.statuses}
+			client := http.Client{
+				Transport: &Retry{NextRoundTrip: next, Attempts: tt.attempts, Wait: time.Millisecond},
+			}
+
+			resp, err := client.Get(server)
+			if err != nil {
+				t.Fatalf("did not expect error, got %s", err)
+			}
+			if resp.StatusCode != tt.wantStatus || next.calls != tt.wantCalls {
+				t.Errorf("want status %d after %d calls, got %d after %d calls", tt.wantStatus, tt.wantCalls, resp.StatusCode, next.calls)
+			}
+		})
+	}
+}
+
+func TestRetry_RoundTripRewindsBody(t *testing.T) {
+	next := &statusRoundTrip{statuses: []int{429, 200}}
+	client := http.Client{
+		Transport: &Retry{NextRoundTrip: next, Attempts: 3, Wait: time.Millisecond},
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, server, strings.NewReader(`{"content":"192.168.0.2"}`))
+	if err != nil {
+		t.Fatalf("could not create request: %s", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("did not expect error, got %s", err)
+	}
+	if resp.StatusCode != 200 || len(next.bodies) != 2 || next.bodies[0] != next.bodies[1] {
+		t.Errorf("expected the same body to be sent twice, got status %d and bodies %q", resp.StatusCode, next.bodies)
+	}
+}
+
+func TestRetry_RoundTripDoesNotRetryBodyThatCannotBeRewound(t *testing.T) {
+	next := &statusRoundTrip{statuses: []int{429, 200}}
+	client := http.Client{
+		Transport: &Retry{NextRoundTrip: next, Attempts: 3, Wait: time.Millisecond},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server, ioutil.NopCloser(strings.NewReader(`{"content":"192.168.0.2"}`)))
+	if err != nil {
+		t.Fatalf("could not create request: %s", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("did not expect error, got %s", err)
+	}
+	if resp.StatusCode != 429 || next.calls != 1 {
+		t.Errorf("expected the rate limited response without retrying, got status %d after %d calls", resp.StatusCode, next.calls)
+	}
+}
+
+func TestRetry_RoundTripStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	retry := &Retry{NextRoundTrip: &statusRoundTrip{statuses: []int{503, 200}}, Attempts: 3, Wait: time.Hour}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server, nil)
+	if err != nil {
+		t.Fatalf("could not create request: %s", err)
+	}
+
+	resp, err := retry.RoundTrip(req)
+	if resp != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected no response and the cancellation, got %v (%v)", resp, err)
+	}
+}
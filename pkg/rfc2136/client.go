@@ -0,0 +1,317 @@
+package rfc2136
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTTL is used for records without a TTL, as CloudFlare's automatic TTL of 1 has no equivalent.
+	DefaultTTL = 300
+	// DefaultAlgorithm is the TSIG algorithm used when none is given.
+	DefaultAlgorithm = "hmac-sha256"
+
+	// fudge is the allowed clock skew of TSIG signatures in seconds.
+	fudge = 300
+)
+
+// Client updates DNS records on an authoritative name server with RFC 2136 dynamic updates.
+// DNS has no place for comments, so the ownership comment of a record is kept in a TXT record
+// with the same name. Tags and proxying are not supported.
+type Client struct {
+	client    *dns.Client
+	server    string
+	zone      string
+	key       string
+	algorithm string
+}
+
+// Zone sets the zone the records are updated in, the last two labels of the record name by default.
+func Zone(zone string) func(*Client) {
+	return func(c *Client) {
+		c.zone = dns.Fqdn(zone)
+	}
+}
+
+// TSIG signs the messages to the name server with the named key and its base64 encoded secret.
+// The algorithm is DefaultAlgorithm if empty.
+func TSIG(key, secret, algorithm string) func(*Client) {
+	return func(c *Client) {
+		if algorithm == "" {
+			algorithm = DefaultAlgorithm
+		}
+
+		c.key = dns.Fqdn(key)
+		c.algorithm = dns.Fqdn(algorithm)
+		c.client.TsigSecret = map[string]string{c.key: secret}
+	}
+}
+
+// Network sets the transport used for talking to the name server, either "udp" or "tcp".
+func Network(network string) func(*Client) {
+	return func(c *Client) {
+		c.client.Net = network
+	}
+}
+
+// Timeout sets the timeout of a single exchange with the name server.
+func Timeout(duration time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.client.Timeout = duration
+	}
+}
+
+// NewClient returns a client updating records on the name server, given as host or host:port.
+func NewClient(server string, options ...func(*Client)) (*Client, error) {
+	if server == "" {
+		return nil, fmt.Errorf("no name server configured")
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	c := &Client{
+		client: &dns.Client{Net: "udp", Timeout: time.Second * 10},
+		server: server,
+	}
+	for _, o := range options {
+		o(c)
+	}
+
+	return c, nil
+}
+
+// GetRecord will return the DNS record matching the given name and type.
+// Returns an error if there are either no records or duplicate records found.
+func (c *Client) GetRecord(ctx context.Context, name string, recordType cloudflare.Type) (rec cloudflare.Record, err error) {
+	rrType, ok := dns.StringToType[string(recordType)]
+	if !ok {
+		return rec, fmt.Errorf("unsupported record type %q", recordType)
+	}
+
+	rrs, err := c.query(ctx, name, rrType)
+	if err != nil {
+		return rec, err
+	}
+
+	if len(rrs) == 0 {
+		return rec, fmt.Errorf("no record for %q of type %s found", name, recordType)
+	}
+
+	if len(rrs) > 1 {
+		return rec, fmt.Errorf("found duplicate entry for %q and type %q", name, recordType)
+	}
+
+	comment, err := c.comment(ctx, name)
+	if err != nil {
+		return rec, err
+	}
+
+	zone := c.zoneOf(name)
+	return cloudflare.Record{
+		ID:       fmt.Sprintf("%s/%s", name, recordType),
+		ZoneID:   strings.TrimSuffix(zone, "."),
+		ZoneName: strings.TrimSuffix(zone, "."),
+		Type:     recordType,
+		Name:     name,
+		Content:  content(rrs[0]),
+		TTL:      int(rrs[0].Header().Ttl),
+		Comment:  comment,
+	}, nil
+}
+
+// CreateRecord adds a record, along with the TXT record holding its comment.
+func (c *Client) CreateRecord(ctx context.Context, request cloudflare.DNSUpdateRequest) (cloudflare.Record, error) {
+	rr, err := newRR(request.Name, request.Type, request.Content, ttl(request.TTL))
+	if err != nil {
+		return cloudflare.Record{}, err
+	}
+
+	zone := c.zoneOf(request.Name)
+	m := &dns.Msg{}
+	m.SetUpdate(zone)
+	m.Insert([]dns.RR{rr})
+
+	rec := cloudflare.Record{
+		ID:       fmt.Sprintf("%s/%s", request.Name, request.Type),
+		ZoneID:   strings.TrimSuffix(zone, "."),
+		ZoneName: strings.TrimSuffix(zone, "."),
+		Type:     request.Type,
+		Name:     request.Name,
+		Content:  request.Content,
+		TTL:      ttl(request.TTL),
+	}
+	if request.Comment != nil && *request.Comment != "" {
+		m.Insert([]dns.RR{newTXT(request.Name, *request.Comment, rec.TTL)})
+		rec.Comment = *request.Comment
+	}
+
+	if _, err := c.exchange(ctx, m); err != nil {
+		return cloudflare.Record{}, err
+	}
+
+	return rec, nil
+}
+
+// UpdateRecord changes the content, TTL and comment of the record. Other changes are ignored.
+// The update only succeeds if the record still has the content it was read with,
+// so concurrent changes on the name server are never overwritten.
+func (c *Client) UpdateRecord(ctx context.Context, rec cloudflare.Record, request cloudflare.DNSUpdateRequest) error {
+	m := &dns.Msg{}
+	m.SetUpdate(c.zoneOf(rec.Name))
+
+	if request.Content != "" || request.TTL != 0 {
+		desired := rec.Content
+		if request.Content != "" {
+			desired = request.Content
+		}
+		recTTL := rec.TTL
+		if request.TTL != 0 {
+			recTTL = ttl(request.TTL)
+		}
+
+		// Used and Remove take over the records they are given, so each gets its own copy.
+		var rrs [3]dns.RR
+		for i, content := range []string{rec.Content, rec.Content, desired} {
+			rr, err := newRR(rec.Name, rec.Type, content, recTTL)
+			if err != nil {
+				return err
+			}
+			rrs[i] = rr
+		}
+
+		// Prerequisites must have a zero TTL, which Used does not set, or servers refuse the update with FORMERR.
+		rrs[0].Header().Ttl = 0
+		m.Used(rrs[:1])
+		m.Remove(rrs[1:2])
+		m.Insert(rrs[2:])
+	}
+
+	if request.Comment != nil {
+		if rec.Comment != "" {
+			m.Remove([]dns.RR{newTXT(rec.Name, rec.Comment, 0)})
+		}
+		if *request.Comment != "" {
+			m.Insert([]dns.RR{newTXT(rec.Name, *request.Comment, ttl(rec.TTL))})
+		}
+	}
+
+	if len(m.Ns) == 0 {
+		return nil
+	}
+
+	_, err := c.exchange(ctx, m)
+	return err
+}
+
+// query returns the records of the name and type, ignoring any other records in the answer.
+func (c *Client) query(ctx context.Context, name string, rrType uint16) ([]dns.RR, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), rrType)
+
+	r, err := c.exchange(ctx, m)
+	if err != nil {
+		return nil, fmt.Errorf("could not query %s records of %q: %w", dns.TypeToString[rrType], name, err)
+	}
+
+	var rrs []dns.RR
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype == rrType && strings.EqualFold(rr.Header().Name, dns.Fqdn(name)) {
+			rrs = append(rrs, rr)
+		}
+	}
+
+	return rrs, nil
+}
+
+// comment returns the ownership comment kept in a TXT record of the name, if there is one.
+func (c *Client) comment(ctx context.Context, name string) (string, error) {
+	rrs, err := c.query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range rrs {
+		text := strings.Join(rr.(*dns.TXT).Txt, "")
+		if _, managed := (cloudflare.Record{Comment: text}).Owner(); managed {
+			return text, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (c *Client) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if c.key != "" {
+		m.SetTsig(c.key, c.algorithm, fudge, time.Now().Unix())
+	}
+
+	r, _, err := c.client.ExchangeContext(ctx, m, c.server)
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange message with %s: %w", c.server, err)
+	}
+
+	if r.Rcode != dns.RcodeSuccess {
+		return r, &Error{Server: c.server, Opcode: m.Opcode, Rcode: r.Rcode}
+	}
+
+	return r, nil
+}
+
+func (c *Client) zoneOf(name string) string {
+	if c.zone != "" {
+		return c.zone
+	}
+
+	return dns.Fqdn(cloudflare.ZoneName(strings.TrimSuffix(name, ".")))
+}
+
+func newRR(name string, recordType cloudflare.Type, content string, ttl int) (dns.RR, error) {
+	hdr := dns.RR_Header{Name: dns.Fqdn(name), Class: dns.ClassINET, Ttl: uint32(ttl)}
+	ip := net.ParseIP(content)
+
+	switch {
+	case recordType == cloudflare.A && ip.To4() != nil:
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip.To4()}, nil
+	case recordType == cloudflare.AAAA && ip != nil && ip.To4() == nil:
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	default:
+		return nil, fmt.Errorf("%q is not a valid content for a record of type %s", content, recordType)
+	}
+}
+
+func newTXT(name, text string, ttl int) dns.RR {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: dns.Fqdn(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(ttl)},
+		Txt: []string{text},
+	}
+}
+
+func content(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	default:
+		return ""
+	}
+}
+
+// ttl returns the TTL for records, replacing CloudFlare's automatic TTL.
+func ttl(ttl int) int {
+	if ttl <= 1 {
+		return DefaultTTL
+	}
+
+	return ttl
+}
@@ -0,0 +1,221 @@
+package rfc2136_test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/rfc2136"
+	"cloudflare-ddns/pkg/test"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	tsigKey    = "ddns-key"
+	tsigSecret = "c2VjcmV0IGtleSBmb3IgdGVzdGluZw=="
+	managed    = "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host router"
+)
+
+func nameserver(t *testing.T, records ...string) *test.Nameserver {
+	ns, err := test.NewNameserver("nenad.dev", tsigKey, tsigSecret)
+	if err != nil {
+		t.Fatalf("could not start name server: %s", err)
+	}
+
+	for _, rec := range records {
+		if err := ns.Add(rec); err != nil {
+			t.Fatalf("could not add record: %s", err)
+		}
+	}
+
+	return ns
+}
+
+func client(t *testing.T, ns *test.Nameserver, options ...func(*rfc2136.Client)) *rfc2136.Client {
+	options = append([]func(*rfc2136.Client){rfc2136.TSIG(tsigKey, tsigSecret, ""), rfc2136.Timeout(time.Second)}, options...)
+	c, err := rfc2136.NewClient(ns.Addr(), options...)
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	return c
+}
+
+func Test_ClientGetRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		recType cloudflare.Type
+		want    cloudflare.Record
+		err     string
+	}{
+		{
+			name: "managed record carries the comment of its TXT record",
+			records: []string{
+				"home.nenad.dev. 300 IN A 192.168.0.1",
+				"home.nenad.dev. 300 IN TXT \"v=spf1 -all\"",
+				"home.nenad.dev. 300 IN TXT \"" + managed + "\"",
+			},
+			recType: cloudflare.A,
+			want: cloudflare.Record{
+				ID:       "home.nenad.dev/A",
+				ZoneID:   "nenad.dev",
+				ZoneName: "nenad.dev",
+				Type:     cloudflare.A,
+				Name:     "home.nenad.dev",
+				Content:  "192.168.0.1",
+				TTL:      300,
+				Comment:  managed,
+			},
+		},
+		{
+			name:    "unmanaged IPv6 record",
+			records: []string{"home.nenad.dev. 60 IN AAAA 2001:db8::1", "home.nenad.dev. 60 IN A 192.168.0.1"},
+			recType: cloudflare.AAAA,
+			want: cloudflare.Record{
+				ID:       "home.nenad.dev/AAAA",
+				ZoneID:   "nenad.dev",
+				ZoneName: "nenad.dev",
+				Type:     cloudflare.AAAA,
+				Name:     "home.nenad.dev",
+				Content:  "2001:db8::1",
+				TTL:      60,
+			},
+		},
+		{
+			name:    "missing record",
+			records: []string{"home.nenad.dev. 60 IN AAAA 2001:db8::1"},
+			recType: cloudflare.A,
+			err:     "no record",
+		},
+		{
+			name:    "duplicate records",
+			records: []string{"home.nenad.dev. 60 IN A 192.168.0.1", "home.nenad.dev. 60 IN A 192.168.0.2"},
+			recType: cloudflare.A,
+			err:     "duplicate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := nameserver(t, tt.records...)
+			defer ns.Close()
+
+			got, err := client(t, ns).GetRecord(context.Background(), "home.nenad.dev", tt.recType)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect an error: %s", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRecord() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ClientUpdateRecord(t *testing.T) {
+	ns := nameserver(t,
+		"home.nenad.dev. 300 IN A 192.168.0.1",
+		"home.nenad.dev. 300 IN TXT \"v=spf1 -all\"",
+	)
+	defer ns.Close()
+	c := client(t, ns)
+
+	rec, err := c.GetRecord(context.Background(), "home.nenad.dev", cloudflare.A)
+	if err != nil {
+		t.Fatalf("could not get record: %s", err)
+	}
+
+	comment := managed
+	if err := c.UpdateRecord(context.Background(), rec, cloudflare.DNSUpdateRequest{Content: "192.168.0.2", Comment: &comment}); err != nil {
+		t.Fatalf("could not update record: %s", err)
+	}
+
+	want := []string{
+		"home.nenad.dev. 300 IN TXT \"v=spf1 -all\"",
+		"home.nenad.dev. 300 IN A 192.168.0.2",
+		"home.nenad.dev. 300 IN TXT \"" + managed + "\"",
+	}
+	if got := ns.Records("home.nenad.dev"); !reflect.DeepEqual(got, want) {
+		t.Errorf("want records %q, got %q", want, got)
+	}
+
+	// The record no longer has the content it was read with.
+	err = c.UpdateRecord(context.Background(), rec, cloudflare.DNSUpdateRequest{Content: "192.168.0.3"})
+	if !rfc2136.IsConflict(err) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if got := ns.Records("home.nenad.dev"); !reflect.DeepEqual(got, want) {
+		t.Errorf("conflicting update changed records to %q", got)
+	}
+
+	if err := c.UpdateRecord(context.Background(), rec, cloudflare.DNSUpdateRequest{}); err != nil || ns.Updates() != 1 {
+		t.Errorf("expected an empty update to be skipped, got %d updates (%v)", ns.Updates(), err)
+	}
+}
+
+func Test_ClientCreateRecord(t *testing.T) {
+	ns := nameserver(t, "home.nenad.dev. 300 IN A 192.168.0.1")
+	defer ns.Close()
+
+	comment := managed
+	got, err := client(t, ns).CreateRecord(context.Background(), cloudflare.DNSUpdateRequest{
+		Name:    "home.nenad.dev",
+		Type:    cloudflare.A,
+		Content: "192.168.0.2",
+		TTL:     1,
+		Comment: &comment,
+	})
+	if err != nil {
+		t.Fatalf("could not create record: %s", err)
+	}
+
+	if got.Content != "192.168.0.2" || got.TTL != rfc2136.DefaultTTL || got.Comment != managed {
+		t.Errorf("unexpected record created: %#v", got)
+	}
+
+	want := []string{
+		"home.nenad.dev. 300 IN A 192.168.0.1",
+		"home.nenad.dev. 300 IN A 192.168.0.2",
+		"home.nenad.dev. 300 IN TXT \"" + managed + "\"",
+	}
+	if got := ns.Records("home.nenad.dev"); !reflect.DeepEqual(got, want) {
+		t.Errorf("want records %q, got %q", want, got)
+	}
+}
+
+func Test_ClientRequiresTSIG(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []func(*rfc2136.Client)
+	}{
+		{name: "unsigned update"},
+		{name: "update signed with the wrong secret", options: []func(*rfc2136.Client){rfc2136.TSIG(tsigKey, "d3Jvbmc=", "")}},
+		{name: "update for another zone", options: []func(*rfc2136.Client){rfc2136.TSIG(tsigKey, tsigSecret, ""), rfc2136.Zone("nenad.com")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := nameserver(t, "home.nenad.dev. 300 IN A 192.168.0.1")
+			defer ns.Close()
+
+			c, err := rfc2136.NewClient(ns.Addr(), append([]func(*rfc2136.Client){rfc2136.Timeout(time.Second)}, tt.options...)...)
+			if err != nil {
+				t.Fatalf("could not create client: %s", err)
+			}
+
+			rec := cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", TTL: 300}
+			err = c.UpdateRecord(context.Background(), rec, cloudflare.DNSUpdateRequest{Content: "192.168.0.2"})
+			if err == nil || ns.Updates() != 0 {
+				t.Fatalf("expected the update to be refused, got %d updates (%v)", ns.Updates(), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package rfc2136
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// Error is an unsuccessful response from the name server.
+type Error struct {
+	Server string
+	Opcode int
+	Rcode  int
+}
+
+// Error returns the operation and the response code of the name server.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s to %s failed: %s", dns.OpcodeToString[e.Opcode], e.Server, dns.RcodeToString[e.Rcode])
+}
+
+// IsAuthError reports whether the name server refused the message, usually because of a missing or wrong TSIG key.
+func IsAuthError(err error) bool {
+	var dnsErr *Error
+	if !errors.As(err, &dnsErr) {
+		return false
+	}
+
+	return dnsErr.Rcode == dns.RcodeNotAuth || dnsErr.Rcode == dns.RcodeRefused
+}
+
+// IsConflict reports whether an update was rejected because the record changed since it was read.
+func IsConflict(err error) bool {
+	var dnsErr *Error
+	if !errors.As(err, &dnsErr) {
+		return false
+	}
+
+	return dnsErr.Rcode == dns.RcodeNXRrset
+}
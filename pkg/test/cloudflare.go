@@ -0,0 +1,482 @@
+package test
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// CloudFlare is an in-process fake of CloudFlare's API. It serves zones and their DNS records,
+	// supporting listing with filters and pagination, and getting, creating, patching, replacing
+	// and deleting records. Failures can be injected with Fail.
+	// Requests are authenticated with the API token, a zone's token or a Global API Key, as CloudFlare does.
+	CloudFlare struct {
+		server     *httptest.Server
+		token      string
+		zoneTokens map[string]string // zoneTokens are the tokens of single zones, by zone name.
+		email      string
+		key        string
+		mu         sync.Mutex
+		zones      []*fakeZone
+		failures   []Failure
+		requests   []string
+		lastID     int
+	}
+
+	// Failure is an error response returned by the fake instead of handling a matching request.
+	Failure struct {
+		Method     string // Method of the matching requests, any method if empty.
+		Path       string // Path prefix of the matching requests below the API URL, any path if empty.
+		Status     int    // Status is the HTTP status of the response.
+		Code       int    // Code is the CloudFlare error code, if zero an HTML page is returned as from the edge.
+		Message    string // Message is the CloudFlare error message.
+		RetryAfter int    // RetryAfter sets the Retry-After header in seconds, if not zero.
+	}
+
+	fakeZone struct {
+		zone    cloudflare.Zone
+		records []cloudflare.Record
+	}
+
+	fakeResponse struct {
+		Result     interface{}        `json:"result"`
+		ResultInfo *fakeResultInfo    `json:"result_info,omitempty"`
+		Success    bool               `json:"success"`
+		Errors     []cloudflare.Error `json:"errors"`
+		Messages   []interface{}      `json:"messages"`
+	}
+
+	fakeResultInfo struct {
+		Page       int `json:"page"`
+		PerPage    int `json:"per_page"`
+		TotalPages int `json:"total_pages"`
+		Count      int `json:"count"`
+		TotalCount int `json:"total_count"`
+	}
+)
+
+const fakeAPIPath = "/client/v4"
+
+// NewCloudFlare starts a fake CloudFlare API accepting the given API token.
+// The fake must be closed after use.
+func NewCloudFlare(token string) *CloudFlare {
+	c := &CloudFlare{token: token, zoneTokens: map[string]string{}}
+	c.server = httptest.NewServer(c)
+	return c
+}
+
+// URL returns the base URL of the fake API, for use with cloudflare.BaseURL.
+func (c *CloudFlare) URL() string {
+	return c.server.URL + fakeAPIPath
+}
+
+// Close shuts the fake down.
+func (c *CloudFlare) Close() {
+	c.server.Close()
+}
+
+// ZoneToken makes the fake accept the token for requests to the named zone only.
+func (c *CloudFlare) ZoneToken(zone, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.zoneTokens[zone] = token
+}
+
+// GlobalKey makes the fake accept the Global API Key of the account with the email.
+func (c *CloudFlare) GlobalKey(email, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.email, c.key = email, key
+}
+
+// Permissions sets the permissions reported on the named zone, creating it if needed.
+// Nil permissions are not reported at all.
+func (c *CloudFlare) Permissions(zone string, permissions []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z := c.zone(zone)
+	if z == nil {
+		z = c.addZone(zone)
+	}
+	z.zone.Permissions = permissions
+}
+
+// AddZone adds a zone with the given name and returns its ID.
+func (c *CloudFlare) AddZone(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.addZone(name).zone.ID
+}
+
+// AddRecord adds the record to the zone it belongs to, creating the zone if needed, and returns the stored record.
+func (c *CloudFlare) AddRecord(rec cloudflare.Record) cloudflare.Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z := c.zone(cloudflare.ZoneName(rec.Name))
+	if z == nil {
+		z = c.addZone(cloudflare.ZoneName(rec.Name))
+	}
+	rec = c.store(z, rec)
+	z.records = append(z.records, rec)
+	return rec
+}
+
+// Records returns the records of the named zone.
+func (c *CloudFlare) Records(zone string) []cloudflare.Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z := c.zone(zone)
+	if z == nil {
+		return nil
+	}
+
+	return append([]cloudflare.Record(nil), z.records...)
+}
+
+// Fail queues a failure, returned once for the next matching request.
+func (c *CloudFlare) Fail(f Failure) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures = append(c.failures, f)
+}
+
+// Requests returns the method and path of every request received so far, such as "GET /zones".
+func (c *CloudFlare) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.requests...)
+}
+
+// ServeHTTP handles a request to the fake API.
+func (c *CloudFlare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, fakeAPIPath)
+	c.requests = append(c.requests, fmt.Sprintf("%s %s", r.Method, path))
+	w.Header().Set("CF-Ray", fmt.Sprintf("%016x-TST", len(c.requests)))
+
+	if f, ok := c.failure(r.Method, path); ok {
+		writeFailure(w, f)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if r.Header.Get("X-Auth-Key") != "" || r.Header.Get("X-Auth-Email") != "" {
+		if c.key == "" || r.Header.Get("X-Auth-Email") != c.email || r.Header.Get("X-Auth-Key") != c.key {
+			writeError(w, http.StatusForbidden, cloudflare.CodeUnknownAuthKey, "Unknown X-Auth-Key or X-Auth-Email")
+			return
+		}
+	} else if !c.authorized(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), r, parts) {
+		writeError(w, http.StatusForbidden, cloudflare.CodeInvalidAccessToken, "Invalid access token")
+		return
+	}
+
+	switch {
+	case path == "/user/tokens/verify" && r.Method == "GET":
+		writeResult(w, http.StatusOK, map[string]string{"id": "token", "status": "active"}, nil)
+	case path == "/zones" && r.Method == "GET":
+		c.listZones(w, r)
+	case len(parts) == 3 && parts[0] == "zones" && parts[2] == "dns_records":
+		c.handleRecords(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "zones" && parts[2] == "dns_records":
+		c.handleRecord(w, r, parts[1], parts[3])
+	default:
+		writeError(w, http.StatusNotFound, 7003, "Could not route to "+path)
+	}
+}
+
+// authorized reports whether the token is the API token, or the token of the zone the request is for.
+// Any known token can be verified.
+func (c *CloudFlare) authorized(token string, r *http.Request, parts []string) bool {
+	if token == "" {
+		return false
+	}
+	if token == c.token {
+		return true
+	}
+
+	zone := r.URL.Query().Get("name")
+	switch {
+	case parts[0] == "user":
+		for _, t := range c.zoneTokens {
+			if t == token {
+				return true
+			}
+		}
+		return false
+	case len(parts) > 1 && parts[0] == "zones":
+		if z := c.zoneByID(parts[1]); z != nil {
+			zone = z.zone.Name
+		}
+	}
+
+	t, ok := c.zoneTokens[zone]
+	return ok && t == token
+}
+
+func (c *CloudFlare) listZones(w http.ResponseWriter, r *http.Request) {
+	zones := []cloudflare.Zone{}
+	for _, z := range c.zones {
+		if name := r.URL.Query().Get("name"); name == "" || name == z.zone.Name {
+			zones = append(zones, z.zone)
+		}
+	}
+
+	writeResult(w, http.StatusOK, zones, &fakeResultInfo{Page: 1, PerPage: 20, TotalPages: 1, Count: len(zones), TotalCount: len(zones)})
+}
+
+func (c *CloudFlare) handleRecords(w http.ResponseWriter, r *http.Request, zoneID string) {
+	z := c.zoneByID(zoneID)
+	if z == nil {
+		writeError(w, http.StatusNotFound, 1001, "Invalid zone identifier")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		matching := []cloudflare.Record{}
+		for _, rec := range z.records {
+			if (q.Get("name") == "" || q.Get("name") == rec.Name) && (q.Get("type") == "" || q.Get("type") == string(rec.Type)) {
+				matching = append(matching, rec)
+			}
+		}
+
+		page, perPage := queryInt(q.Get("page"), 1), queryInt(q.Get("per_page"), 100)
+		start, end := (page-1)*perPage, page*perPage
+		if start > len(matching) {
+			start = len(matching)
+		}
+		if end > len(matching) {
+			end = len(matching)
+		}
+
+		writeResult(w, http.StatusOK, matching[start:end], &fakeResultInfo{
+			Page:       page,
+			PerPage:    perPage,
+			TotalPages: (len(matching) + perPage - 1) / perPage,
+			Count:      end - start,
+			TotalCount: len(matching),
+		})
+	case "POST":
+		req := cloudflare.DNSUpdateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Type == "" || req.Content == "" {
+			writeError(w, http.StatusBadRequest, 9000, "Invalid DNS record")
+			return
+		}
+
+		for _, rec := range z.records {
+			if rec.Name == req.Name && rec.Type == req.Type && rec.Content == req.Content {
+				writeError(w, http.StatusBadRequest, cloudflare.CodeIdenticalRecord, "An identical record already exists.")
+				return
+			}
+		}
+
+		rec := cloudflare.Record{}
+		apply(&rec, req)
+		rec = c.store(z, rec)
+		z.records = append(z.records, rec)
+		writeResult(w, http.StatusOK, rec, nil)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, 7001, "Method not allowed for this endpoint")
+	}
+}
+
+func (c *CloudFlare) handleRecord(w http.ResponseWriter, r *http.Request, zoneID, id string) {
+	z := c.zoneByID(zoneID)
+	i := -1
+	if z != nil {
+		for j, rec := range z.records {
+			if rec.ID == id {
+				i = j
+			}
+		}
+	}
+	if i < 0 {
+		writeError(w, http.StatusNotFound, cloudflare.CodeRecordNotFound, "Record does not exist.")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeResult(w, http.StatusOK, z.records[i], nil)
+	case "PATCH", "PUT":
+		req := cloudflare.DNSUpdateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, 9000, "Invalid DNS record")
+			return
+		}
+
+		rec := z.records[i]
+		if r.Method == "PUT" {
+			rec = cloudflare.Record{ID: rec.ID, CreatedOn: rec.CreatedOn}
+		}
+		apply(&rec, req)
+		rec = c.store(z, rec)
+		z.records[i] = rec
+		writeResult(w, http.StatusOK, rec, nil)
+	case "DELETE":
+		z.records = append(z.records[:i], z.records[i+1:]...)
+		writeResult(w, http.StatusOK, map[string]string{"id": id}, nil)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, 7001, "Method not allowed for this endpoint")
+	}
+}
+
+// store fills in the fields CloudFlare manages for a record that is about to be stored in the zone.
+func (c *CloudFlare) store(z *fakeZone, rec cloudflare.Record) cloudflare.Record {
+	now := time.Now().UTC()
+	if rec.ID == "" {
+		rec.ID = c.nextID("record")
+	}
+	if rec.CreatedOn.IsZero() {
+		rec.CreatedOn = now
+	}
+	if rec.TTL == 0 {
+		rec.TTL = 1
+	}
+	rec.ModifiedOn = now
+	rec.ZoneID = z.zone.ID
+	rec.ZoneName = z.zone.Name
+	rec.Proxiable = rec.Type == cloudflare.A || rec.Type == cloudflare.AAAA || rec.Type == cloudflare.CNAME
+
+	return rec
+}
+
+func (c *CloudFlare) failure(method, path string) (Failure, bool) {
+	for i, f := range c.failures {
+		if (f.Method == "" || f.Method == method) && strings.HasPrefix(path, f.Path) {
+			c.failures = append(c.failures[:i], c.failures[i+1:]...)
+			return f, true
+		}
+	}
+
+	return Failure{}, false
+}
+
+func (c *CloudFlare) addZone(name string) *fakeZone {
+	z := &fakeZone{zone: cloudflare.Zone{
+		ID:          c.nextID("zone"),
+		Name:        name,
+		Status:      "active",
+		Permissions: cloudflare.RequiredPermissions,
+	}}
+	c.zones = append(c.zones, z)
+	return z
+}
+
+func (c *CloudFlare) zone(name string) *fakeZone {
+	for _, z := range c.zones {
+		if z.zone.Name == name {
+			return z
+		}
+	}
+
+	return nil
+}
+
+func (c *CloudFlare) zoneByID(id string) *fakeZone {
+	for _, z := range c.zones {
+		if z.zone.ID == id {
+			return z
+		}
+	}
+
+	return nil
+}
+
+func (c *CloudFlare) nextID(prefix string) string {
+	c.lastID++
+	return fmt.Sprintf("%s%d", prefix, c.lastID)
+}
+
+// apply sets the fields present in the request on the record.
+func apply(rec *cloudflare.Record, req cloudflare.DNSUpdateRequest) {
+	if req.Name != "" {
+		rec.Name = req.Name
+	}
+	if req.Type != "" {
+		rec.Type = req.Type
+	}
+	if req.Content != "" {
+		rec.Content = req.Content
+	}
+	if req.Priority != nil {
+		rec.Priority = req.Priority
+		if *req.Priority == 0 {
+			rec.Priority = nil
+		}
+	}
+	if req.Data != nil {
+		rec.Data = *req.Data
+		if len(rec.Data) == 0 {
+			rec.Data = nil
+		}
+	}
+	if req.Proxied != nil {
+		rec.Proxied = *req.Proxied
+	}
+	if req.TTL != 0 {
+		rec.TTL = req.TTL
+	}
+	if req.Comment != nil {
+		rec.Comment = *req.Comment
+	}
+	if req.Tags != nil {
+		rec.Tags = *req.Tags
+	}
+}
+
+func queryInt(value string, def int) int {
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 {
+		return def
+	}
+
+	return i
+}
+
+func writeResult(w http.ResponseWriter, status int, result interface{}, info *fakeResultInfo) {
+	writeJSON(w, status, fakeResponse{Result: result, ResultInfo: info, Success: true, Errors: []cloudflare.Error{}})
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, fakeResponse{Errors: []cloudflare.Error{{Code: code, Message: message}}})
+}
+
+func writeFailure(w http.ResponseWriter, f Failure) {
+	if f.RetryAfter != 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+	}
+
+	if f.Code != 0 {
+		writeError(w, f.Status, f.Code, f.Message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(f.Status)
+	_, _ = fmt.Fprintf(w, "<html><body><h1>%d %s</h1></body></html>", f.Status, http.StatusText(f.Status))
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp fakeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"cloudflare-ddns/pkg/ip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+type (
+	// IPStep is a single scripted result of an IPSequence, either an IP or an error.
+	IPStep struct {
+		IP  string
+		Err error
+	}
+
+	// IPSequence is an ip.Retriever that replays scripted results per IP version.
+	// Once the steps of a version are exhausted, its last step is repeated.
+	IPSequence struct {
+		mu    sync.Mutex
+		steps map[ip.Version][]IPStep
+		calls map[ip.Version]int
+	}
+
+	// IPify is an httptest-based stand-in for ipify, answering with the results of a retriever.
+	IPify struct {
+		server    *httptest.Server
+		retriever ip.Retriever
+	}
+)
+
+// NewIPSequence returns a retriever replaying the given steps per IP version.
+func NewIPSequence(steps map[ip.Version][]IPStep) *IPSequence {
+	return &IPSequence{
+		steps: steps,
+		calls: map[ip.Version]int{},
+	}
+}
+
+// IPs returns steps that successfully retrieve the given IPs in order.
+func IPs(ips ...string) []IPStep {
+	steps := make([]IPStep, 0, len(ips))
+	for _, i := range ips {
+		steps = append(steps, IPStep{IP: i})
+	}
+
+	return steps
+}
+
+// Get returns the next scripted result for the version.
+func (s *IPSequence) Get(version ip.Version) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	steps := s.steps[version]
+	if len(steps) == 0 {
+		return "", fmt.Errorf("no IP scripted for version %q", version)
+	}
+
+	i := s.calls[version]
+	s.calls[version]++
+	if i >= len(steps) {
+		i = len(steps) - 1
+	}
+
+	return steps[i].IP, steps[i].Err
+}
+
+// Calls returns how many times an IP of the version was retrieved.
+func (s *IPSequence) Calls(version ip.Version) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[version]
+}
+
+// NewIPify starts an ipify stand-in answering with the results of the retriever.
+// Errors from the retriever are answered with a 500 status code. The stand-in must be closed after use.
+func NewIPify(retriever ip.Retriever) *IPify {
+	i := &IPify{retriever: retriever}
+	i.server = httptest.NewServer(i)
+	return i
+}
+
+// URL returns the URL answering with IPs of the given version, for use with ip.URL.
+func (i *IPify) URL(version ip.Version) string {
+	return fmt.Sprintf("%s/%s", i.server.URL, version)
+}
+
+// Close shuts the stand-in down.
+func (i *IPify) Close() {
+	i.server.Close()
+}
+
+// ServeHTTP answers with the IP of the version named by the path.
+func (i *IPify) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	addr, err := i.retriever.Get(ip.Version(strings.TrimPrefix(r.URL.Path, "/")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = fmt.Fprint(w, addr)
+}
@@ -0,0 +1,247 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Nameserver is an in-process authoritative name server for a single zone, answering queries
+// and applying RFC 2136 dynamic updates over UDP. When a TSIG key is set, updates must be signed with it.
+type Nameserver struct {
+	server  *dns.Server
+	zone    string
+	key     string
+	mu      sync.Mutex
+	records []dns.RR
+	updates int
+}
+
+// NewNameserver starts a name server for the zone, accepting updates signed with the named key and
+// its base64 encoded secret, or unsigned updates if the key is empty. The name server must be closed after use.
+func NewNameserver(zone, key, secret string) (*Nameserver, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+
+	ns := &Nameserver{zone: dns.Fqdn(zone)}
+	started := make(chan struct{})
+	ns.server = &dns.Server{
+		PacketConn:        pc,
+		Handler:           ns,
+		MsgAcceptFunc:     acceptUpdates,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	if key != "" {
+		ns.key = dns.Fqdn(key)
+		ns.server.TsigSecret = map[string]string{ns.key: secret}
+	}
+
+	go func() { _ = ns.server.ActivateAndServe() }()
+	<-started
+
+	return ns, nil
+}
+
+// Addr returns the address of the name server, for use with rfc2136.NewClient.
+func (n *Nameserver) Addr() string {
+	return n.server.PacketConn.LocalAddr().String()
+}
+
+// Close shuts the name server down.
+func (n *Nameserver) Close() {
+	_ = n.server.Shutdown()
+}
+
+// Add adds a record given in zone file format, such as "home.nenad.dev. 300 IN A 192.168.0.1".
+func (n *Nameserver) Add(record string) error {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		return fmt.Errorf("could not parse record: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.records = append(n.records, rr)
+	return nil
+}
+
+// Records returns the records of the name in zone file format, such as "home.nenad.dev. 300 IN A 192.168.0.1".
+func (n *Nameserver) Records(name string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var records []string
+	for _, rr := range n.records {
+		if strings.EqualFold(rr.Header().Name, dns.Fqdn(name)) {
+			records = append(records, strings.ReplaceAll(rr.String(), "\t", " "))
+		}
+	}
+
+	return records
+}
+
+// Updates returns how many updates were applied so far.
+func (n *Nameserver) Updates() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.updates
+}
+
+// ServeDNS answers a query or applies an update.
+func (n *Nameserver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	m := &dns.Msg{}
+	m.SetReply(r)
+	m.Authoritative = true
+
+	tsig := r.IsTsig()
+	switch {
+	case tsig != nil && w.TsigStatus() != nil, r.Opcode == dns.OpcodeUpdate && n.key != "" && tsig == nil:
+		m.Rcode = dns.RcodeNotAuth
+		_ = w.WriteMsg(m)
+		return
+	case len(r.Question) != 1:
+		m.Rcode = dns.RcodeFormatError
+	case r.Opcode == dns.OpcodeQuery:
+		m.Rcode = n.query(r.Question[0], m)
+	case r.Opcode == dns.OpcodeUpdate:
+		m.Rcode = n.update(r)
+	default:
+		m.Rcode = dns.RcodeNotImplemented
+	}
+
+	if tsig != nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+	_ = w.WriteMsg(m)
+}
+
+func (n *Nameserver) query(q dns.Question, m *dns.Msg) int {
+	if !dns.IsSubDomain(n.zone, q.Name) {
+		return dns.RcodeRefused
+	}
+
+	for _, rr := range n.records {
+		if strings.EqualFold(rr.Header().Name, q.Name) && (q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype) {
+			m.Answer = append(m.Answer, dns.Copy(rr))
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// update checks the prerequisites and applies the updates of the message as described by RFC 2136,
+// either completely or not at all.
+func (n *Nameserver) update(r *dns.Msg) int {
+	if !strings.EqualFold(r.Question[0].Name, n.zone) {
+		return dns.RcodeNotAuth
+	}
+
+	for _, rr := range r.Answer {
+		if rcode := n.prerequisite(rr); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+	}
+
+	records := append([]dns.RR(nil), n.records...)
+	for _, rr := range r.Ns {
+		h := rr.Header()
+		if !dns.IsSubDomain(n.zone, h.Name) {
+			return dns.RcodeNotZone
+		}
+
+		switch h.Class {
+		case dns.ClassINET:
+			records = remove(records, func(stored dns.RR) bool { return dns.IsDuplicate(stored, rr) })
+			records = append(records, dns.Copy(rr))
+		case dns.ClassANY:
+			records = remove(records, func(stored dns.RR) bool {
+				return strings.EqualFold(stored.Header().Name, h.Name) && (h.Rrtype == dns.TypeANY || stored.Header().Rrtype == h.Rrtype)
+			})
+		case dns.ClassNONE:
+			removed := dns.Copy(rr)
+			removed.Header().Class = dns.ClassINET
+			records = remove(records, func(stored dns.RR) bool { return dns.IsDuplicate(stored, removed) })
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	n.records = records
+	n.updates++
+	return dns.RcodeSuccess
+}
+
+// prerequisite checks a single prerequisite of an update, see RFC 2136 section 2.4.
+func (n *Nameserver) prerequisite(rr dns.RR) int {
+	h := rr.Header()
+	if h.Ttl != 0 {
+		return dns.RcodeFormatError
+	}
+	exists := func(match func(dns.RR) bool) bool {
+		for _, stored := range n.records {
+			if strings.EqualFold(stored.Header().Name, h.Name) && match(stored) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case h.Class == dns.ClassANY && h.Rrtype == dns.TypeANY:
+		if !exists(func(dns.RR) bool { return true }) {
+			return dns.RcodeNameError
+		}
+	case h.Class == dns.ClassANY:
+		if !exists(func(stored dns.RR) bool { return stored.Header().Rrtype == h.Rrtype }) {
+			return dns.RcodeNXRrset
+		}
+	case h.Class == dns.ClassNONE && h.Rrtype == dns.TypeANY:
+		if exists(func(dns.RR) bool { return true }) {
+			return dns.RcodeYXDomain
+		}
+	case h.Class == dns.ClassNONE:
+		if exists(func(stored dns.RR) bool { return stored.Header().Rrtype == h.Rrtype }) {
+			return dns.RcodeYXRrset
+		}
+	case h.Class == dns.ClassINET:
+		// The TTL of the prerequisite is zero, so records match whatever their TTL is.
+		if !exists(func(stored dns.RR) bool { return dns.IsDuplicate(stored, rr) }) {
+			return dns.RcodeNXRrset
+		}
+	default:
+		return dns.RcodeFormatError
+	}
+
+	return dns.RcodeSuccess
+}
+
+// acceptUpdates accepts the updates rejected by dns.DefaultMsgAcceptFunc, leaving their validation to ServeDNS.
+func acceptUpdates(dh dns.Header) dns.MsgAcceptAction {
+	if opcode := int(dh.Bits>>11) & 0xF; opcode == dns.OpcodeUpdate && dh.Bits&(1<<15) == 0 {
+		return dns.MsgAccept
+	}
+
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+func remove(records []dns.RR, match func(dns.RR) bool) []dns.RR {
+	kept := records[:0:0]
+	for _, rr := range records {
+		if !match(rr) {
+			kept = append(kept, rr)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,291 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// unlockScript is the script the cache unlocks records with, deleting the lock if it still holds the token.
+	unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+	// refreshScript is the script the cache refreshes locks with, extending the lock if it still holds the token.
+	refreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+// Redis is an in-process server speaking the Redis protocol, supporting the commands the cache uses:
+// AUTH, SELECT, PING, GET, SET with NX and PX, DEL, HSET, HGET, HDEL and EVAL of the scripts unlocking and refreshing locks.
+// Expired keys are removed when they are read.
+type Redis struct {
+	listener net.Listener
+	password string
+	mu       sync.Mutex
+	values   map[string]string
+	hashes   map[string]map[string]string
+	expires  map[string]time.Time
+	commands []string
+}
+
+// NewRedis starts a server requiring the password, or no password if it is empty.
+// The server must be closed after use.
+func NewRedis(password string) (*Redis, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+
+	r := &Redis{listener: l, password: password, values: map[string]string{}, hashes: map[string]map[string]string{}, expires: map[string]time.Time{}}
+	go r.serve()
+
+	return r, nil
+}
+
+// Addr returns the address of the server, as host:port.
+func (r *Redis) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Close stops accepting connections.
+func (r *Redis) Close() {
+	_ = r.listener.Close()
+}
+
+// Get returns the value of the key in the selected database, as "db/key", and whether it is set.
+func (r *Redis) Get(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.get(key)
+}
+
+// Set sets the value of the key in the selected database, as "db/key".
+func (r *Redis) Set(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values[key] = value
+}
+
+// Hash returns the fields of the hash in the selected database, as "db/key".
+func (r *Redis) Hash(key string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fields := map[string]string{}
+	for field, value := range r.hashes[key] {
+		fields[field] = value
+	}
+
+	return fields
+}
+
+// Commands returns the names of the commands received so far.
+func (r *Redis) Commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.commands...)
+}
+
+func (r *Redis) serve() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go r.handle(conn)
+	}
+}
+
+func (r *Redis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	authenticated := r.password == ""
+	db := "0"
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		reply := r.exec(args, &authenticated, &db)
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (r *Redis) exec(args []string, authenticated *bool, db *string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := strings.ToUpper(args[0])
+	r.commands = append(r.commands, name)
+
+	switch {
+	case name == "AUTH" && len(args) == 2:
+		if args[1] != r.password {
+			return "-WRONGPASS invalid username-password pair\r\n"
+		}
+		*authenticated = true
+		return "+OK\r\n"
+	case !*authenticated:
+		return "-NOAUTH Authentication required.\r\n"
+	case name == "PING":
+		return "+PONG\r\n"
+	case name == "SELECT" && len(args) == 2:
+		*db = args[1]
+		return "+OK\r\n"
+	case name == "GET" && len(args) == 2:
+		value, ok := r.get(*db + "/" + args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case name == "SET" && len(args) >= 3:
+		key := *db + "/" + args[1]
+		var ttl time.Duration
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if _, ok := r.get(key); ok {
+					return "$-1\r\n"
+				}
+			case "PX":
+				if i+1 == len(args) {
+					return "-ERR syntax error\r\n"
+				}
+				ms, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					return "-ERR value is not an integer or out of range\r\n"
+				}
+				ttl, i = time.Duration(ms)*time.Millisecond, i+1
+			default:
+				return "-ERR syntax error\r\n"
+			}
+		}
+
+		r.values[key] = args[2]
+		delete(r.expires, key)
+		if ttl > 0 {
+			r.expires[key] = time.Now().Add(ttl)
+		}
+		return "+OK\r\n"
+	case name == "DEL" && len(args) >= 2:
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := r.get(*db + "/" + key); ok {
+				delete(r.values, *db+"/"+key)
+				deleted++
+			} else if _, ok := r.hashes[*db+"/"+key]; ok {
+				delete(r.hashes, *db+"/"+key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case name == "HSET" && len(args) >= 4 && len(args)%2 == 0:
+		key := *db + "/" + args[1]
+		if r.hashes[key] == nil {
+			r.hashes[key] = map[string]string{}
+		}
+		added := 0
+		for i := 2; i < len(args); i += 2 {
+			if _, ok := r.hashes[key][args[i]]; !ok {
+				added++
+			}
+			r.hashes[key][args[i]] = args[i+1]
+		}
+		return fmt.Sprintf(":%d\r\n", added)
+	case name == "HGET" && len(args) == 3:
+		value, ok := r.hashes[*db+"/"+args[1]][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case name == "HDEL" && len(args) >= 3:
+		key := *db + "/" + args[1]
+		deleted := 0
+		for _, field := range args[2:] {
+			if _, ok := r.hashes[key][field]; ok {
+				delete(r.hashes[key], field)
+				deleted++
+			}
+		}
+		if len(r.hashes[key]) == 0 {
+			delete(r.hashes, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case name == "EVAL" && len(args) == 5 && args[1] == unlockScript && args[2] == "1":
+		key := *db + "/" + args[3]
+		if value, ok := r.get(key); !ok || value != args[4] {
+			return ":0\r\n"
+		}
+		delete(r.values, key)
+		delete(r.expires, key)
+		return ":1\r\n"
+	case name == "EVAL" && len(args) == 6 && args[1] == refreshScript && args[2] == "1":
+		key := *db + "/" + args[3]
+		ms, err := strconv.Atoi(args[5])
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		if value, ok := r.get(key); !ok || value != args[4] {
+			return ":0\r\n"
+		}
+		r.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// get returns the value of the key unless it expired.
+func (r *Redis) get(key string) (string, bool) {
+	if expires, ok := r.expires[key]; ok && time.Now().After(expires) {
+		delete(r.values, key)
+		delete(r.expires, key)
+	}
+
+	value, ok := r.values[key]
+	return value, ok
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 || !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("invalid command %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid argument %q", line)
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
@@ -0,0 +1,374 @@
+package updater
+
+import (
+	"cloudflare-ddns/pkg/cache"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/config"
+	"cloudflare-ddns/pkg/history"
+	"cloudflare-ddns/pkg/ip"
+	"cloudflare-ddns/pkg/journal"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Skipped means the IP and settings did not change since the cached record, or another process is updating
+	// the record (see Result.Locked), so the DNS provider was not contacted.
+	Skipped Action = "skipped"
+	// Unchanged means the record already points to the IP.
+	Unchanged Action = "unchanged"
+	// Updated means the record was changed to point to the IP.
+	Updated Action = "updated"
+	// Reconciled means the record was changed outside of the updater and was corrected, although the IP did not change.
+	Reconciled Action = "reconciled"
+	// Created means a new record pointing to the IP was added to the record set.
+	Created Action = "created"
+	// Failed means the record could not be updated, see Result.Err.
+	Failed Action = "failed"
+)
+
+type (
+	// DNSProvider is a DNS backend the updater publishes records to. Records of every backend
+	// are described with the CloudFlare types, other backends ignore the fields they do not support.
+	DNSProvider interface {
+		GetRecord(ctx context.Context, name string, recordType cloudflare.Type) (cloudflare.Record, error)
+		CreateRecord(ctx context.Context, request cloudflare.DNSUpdateRequest) (cloudflare.Record, error)
+		UpdateRecord(ctx context.Context, rec cloudflare.Record, request cloudflare.DNSUpdateRequest) error
+	}
+
+	// RecordSetProvider is implemented by providers that can list every record of a name, which -record-set requires.
+	RecordSetProvider interface {
+		GetRecords(ctx context.Context, name string, recordType cloudflare.Type) ([]cloudflare.Record, error)
+	}
+
+	// Locker is implemented by caches that can stop other processes from updating a record at the same time.
+	Locker interface {
+		Lock(domain, recordType string) (unlock func() error, err error)
+	}
+
+	// Verifier is implemented by providers that can check their credentials before the first update.
+	Verifier interface {
+		Verify(ctx context.Context, domain string) cloudflare.Verification
+	}
+
+	// Action is what the updater did with a record.
+	Action string
+
+	// Result is the outcome of updating a single record.
+	Result struct {
+		Domain   string
+		Type     cloudflare.Type
+		IP       string            // IP is the current IP, empty if it could not be retrieved.
+		Previous string            // Previous is the content of the record before the update.
+		Record   cloudflare.Record // Record is the record as published after the update.
+		Action   Action
+		Locked   bool // Locked means the update was skipped because another process holds the lock of the record.
+		Err      error
+	}
+
+	// Updater points the configured DNS record to the current IP.
+	Updater struct {
+		retriever ip.Retriever
+		cacher    cache.Cacher
+		locker    Locker
+		provider  DNSProvider
+		cfg       config.Configuration
+		journal   *journal.Journal
+		history   *history.Store
+		now       func() time.Time
+	}
+)
+
+var (
+	_ Locker            = (*cache.Cache)(nil)
+	_ Locker            = (*cache.BoltCache)(nil)
+	_ Locker            = (*cache.RedisCache)(nil)
+	_ DNSProvider       = (*cloudflare.API)(nil)
+	_ RecordSetProvider = (*cloudflare.API)(nil)
+	_ Verifier          = (*cloudflare.API)(nil)
+)
+
+// Journal records every update of the record's content in the journal, so it can be undone.
+func Journal(j *journal.Journal) func(*Updater) {
+	return func(u *Updater) {
+		u.journal = j
+	}
+}
+
+// History records the outcome of every update, including skipped ones, in the history store.
+func History(s *history.Store) func(*Updater) {
+	return func(u *Updater) {
+		u.history = s
+	}
+}
+
+// Lock locks the record with the locker while updating it, instead of with the cache.
+// It is needed when the cache cannot lock records, such as when caching is disabled.
+func Lock(l Locker) func(*Updater) {
+	return func(u *Updater) {
+		u.locker = l
+	}
+}
+
+// New returns an Updater retrieving the IP from the retriever and updating the record through the provider.
+// Records are locked with the cache while updating them if it is a Locker, see the Lock option otherwise.
+func New(retriever ip.Retriever, cacher cache.Cacher, provider DNSProvider, cfg config.Configuration, options ...func(*Updater)) *Updater {
+	u := &Updater{
+		retriever: retriever,
+		cacher:    cacher,
+		provider:  provider,
+		cfg:       cfg,
+		now:       time.Now,
+	}
+	if l, ok := cacher.(Locker); ok {
+		u.locker = l
+	}
+	for _, option := range options {
+		option(u)
+	}
+
+	return u
+}
+
+// Update points the configured record to the current IP, unless the cache shows that the IP did not change.
+// Cached records are still read again once the reconcile interval passed, correcting changes made by others.
+// The update is skipped if another process holds the lock of the record.
+func (u *Updater) Update(ctx context.Context) (res Result) {
+	cfg := u.cfg.CloudFlare
+	// The lock is held from reading the cache until the updated record, the journal and the history are saved.
+	if u.locker != nil {
+		unlock, err := u.locker.Lock(cfg.Domain, cfg.Type)
+		if errors.Is(err, cache.ErrLocked) {
+			return Result{Domain: cfg.Domain, Type: cloudflare.Type(cfg.Type), Action: Skipped, Locked: true}
+		} else if err != nil {
+			res = Result{Domain: cfg.Domain, Type: cloudflare.Type(cfg.Type)}
+			return u.addHistory(res.fail(fmt.Errorf("could not lock record: %w", err)))
+		}
+		defer func() {
+			if err := unlock(); err != nil && res.Err == nil {
+				res.Err = err
+			}
+		}()
+	}
+
+	return u.addHistory(u.update(ctx))
+}
+
+// addHistory records the outcome of the update in the history, if it is kept.
+func (u *Updater) addHistory(res Result) Result {
+	if u.history == nil {
+		return res
+	}
+
+	e := history.Event{
+		Time:     u.now().UTC(),
+		Domain:   res.Domain,
+		Type:     res.Type,
+		IP:       res.IP,
+		Previous: res.Previous,
+		Action:   string(res.Action),
+	}
+	if res.Err != nil {
+		e.Error = res.Err.Error()
+	}
+	if err := u.history.Append(e); err != nil && res.Err == nil {
+		res.Err = fmt.Errorf("could not save history: %w", err)
+	}
+
+	return res
+}
+
+func (u *Updater) update(ctx context.Context) (res Result) {
+	cfg := u.cfg.CloudFlare
+	res = Result{Domain: cfg.Domain, Type: cloudflare.Type(cfg.Type)}
+
+	myIP, err := u.retriever.Get(cfg.IPVersion)
+	if err != nil {
+		return res.fail(fmt.Errorf("could not get IP: %w", err))
+	}
+	res.IP = myIP
+
+	// A missing or unreadable cache only means the DNS provider has to be asked.
+	cached, _ := u.cacher.GetRecord(cfg.Domain, cfg.Type)
+	upToDate := u.upToDate(cached, myIP)
+	if upToDate && !u.reconcileDue(cached) {
+		res.Previous = cached.Content
+		res.Record = cached.Record()
+		res.Action = Skipped
+		return res
+	}
+
+	// The failure is kept with the cached record, so the next run does not skip it.
+	defer func() {
+		if res.Action == Failed && cached.Name != "" {
+			cached.Error = res.Err.Error()
+			_ = u.cacher.SaveRecord(cached)
+		}
+	}()
+
+	var rec cloudflare.Record
+	if cfg.RecordSet {
+		lister, ok := u.provider.(RecordSetProvider)
+		if !ok {
+			return res.fail(fmt.Errorf("the DNS provider does not support record sets"))
+		}
+
+		recs, err := lister.GetRecords(ctx, cfg.Domain, res.Type)
+		if err != nil {
+			return res.fail(fmt.Errorf("could not get records: %w", err))
+		}
+
+		var found bool
+		if rec, found = cloudflare.FindOwned(recs, cfg.Owner, cached.Content); !found {
+			return u.create(ctx, res)
+		}
+	} else {
+		rec, err = u.provider.GetRecord(ctx, cfg.Domain, res.Type)
+		if err != nil {
+			return res.fail(fmt.Errorf("could not get record: %w", err))
+		}
+
+		if err := u.checkOwnership(rec); err != nil {
+			return res.fail(fmt.Errorf("refusing to update record: %w", err))
+		}
+	}
+	res.Previous = rec.Content
+
+	desired := u.desiredRecord(rec, myIP)
+	res.Record = desired
+	res.Action = Updated
+
+	// The comment is stamped with the time of every update, so it alone does not warrant one.
+	unstamped := desired
+	unstamped.Comment = rec.Comment
+	if owner, managed := rec.Owner(); managed && owner == cfg.Owner && cloudflare.Diff(rec, unstamped).IsEmpty() {
+		res.Record = rec
+		res.Action = Unchanged
+	} else if err := u.provider.UpdateRecord(ctx, rec, cloudflare.Diff(rec, desired)); err != nil {
+		return res.fail(fmt.Errorf("could not update record: %w", err))
+	} else if err := u.record(rec, desired); err != nil {
+		res.Err = fmt.Errorf("could not journal update: %w", err)
+	}
+
+	// The cache claimed the record was up to date, so it was changed by someone else.
+	if upToDate && res.Action == Updated {
+		res.Action = Reconciled
+	}
+
+	if err := u.cacher.SaveRecord(cache.NewEntry(res.Record, u.now())); err != nil {
+		res.Err = fmt.Errorf("could not save cached record: %w", err)
+	}
+
+	return res
+}
+
+// upToDate reports whether the cached record was last published with the IP and the configured settings,
+// and its last update did not fail, so the DNS provider does not need to be asked.
+func (u *Updater) upToDate(cached cache.Entry, ip string) bool {
+	cfg := u.cfg.CloudFlare
+	return cached.Content == ip && cached.Error == "" && cached.TTL == cfg.TTL && cached.Proxied == cfg.Proxied
+}
+
+// reconcileDue reports whether the cached record was verified longer ago than the reconcile interval,
+// so it has to be read again in case it was changed outside of the updater.
+func (u *Updater) reconcileDue(cached cache.Entry) bool {
+	interval := u.cfg.App.Reconcile
+	return interval > 0 && u.now().Sub(cached.Verified) >= interval
+}
+
+// create adds a record for this host to the record set.
+func (u *Updater) create(ctx context.Context, res Result) Result {
+	desired := u.desiredRecord(cloudflare.Record{Name: res.Domain, Type: res.Type}, res.IP)
+	created, err := u.provider.CreateRecord(ctx, cloudflare.Diff(cloudflare.Record{}, desired))
+	if err != nil {
+		return res.fail(fmt.Errorf("could not create record: %w", err))
+	}
+
+	res.Record = created
+	res.Action = Created
+	if err := u.cacher.SaveRecord(cache.NewEntry(created, u.now())); err != nil {
+		res.Err = fmt.Errorf("could not save cached record: %w", err)
+	}
+
+	return res
+}
+
+// record journals the change of the record's content, if there is a journal.
+func (u *Updater) record(rec, desired cloudflare.Record) error {
+	if u.journal == nil || rec.Content == desired.Content {
+		return nil
+	}
+
+	return u.journal.Append(journal.Entry{
+		Time:     u.now().UTC(),
+		ZoneID:   rec.ZoneID,
+		RecordID: rec.ID,
+		Name:     rec.Name,
+		Type:     rec.Type,
+		TTL:      desired.TTL,
+		Old:      rec.Content,
+		New:      desired.Content,
+	})
+}
+
+// desiredRecord returns the record with the given content, marked as managed by the configured owner.
+func (u *Updater) desiredRecord(rec cloudflare.Record, content string) cloudflare.Record {
+	cfg := u.cfg.CloudFlare
+	desired := rec
+	desired.Content = content
+	desired.Proxied = cfg.Proxied
+	desired.TTL = cfg.TTL
+	if cfg.Comment {
+		desired.Comment = cloudflare.ManagedComment(cfg.Owner, u.now())
+	}
+	if cfg.Tag {
+		desired.Tags = cloudflare.WithOwnerTag(rec.Tags, cfg.Owner)
+	}
+
+	return desired
+}
+
+// checkOwnership returns an error if the record is not managed by the configured owner
+// and the configuration does not allow taking it over.
+func (u *Updater) checkOwnership(rec cloudflare.Record) error {
+	cfg := u.cfg.CloudFlare
+	owner, managed := rec.Owner()
+	if !managed && !cfg.Adopt {
+		return fmt.Errorf("record %q is not managed by cloudflare-ddns, use -adopt to take it over", rec.Name)
+	}
+
+	if managed && owner != cfg.Owner && !cfg.Force {
+		return fmt.Errorf("record %q is owned by %q, use -force to update it anyway", rec.Name, owner)
+	}
+
+	return nil
+}
+
+// String describes the result in a single line.
+func (r Result) String() string {
+	switch r.Action {
+	case Skipped:
+		if r.Locked {
+			return fmt.Sprintf("%q is being updated by another process, skipping update", r.Domain)
+		}
+		return fmt.Sprintf("no changes in IP of %q, skipping update", r.Domain)
+	case Unchanged:
+		return fmt.Sprintf("%q already points to %s", r.Domain, r.IP)
+	case Updated:
+		return fmt.Sprintf("Updated %q to point from %s to %s", r.Domain, r.Previous, r.IP)
+	case Reconciled:
+		return fmt.Sprintf("Corrected %q, changed outside of cloudflare-ddns to point to %s, to point to %s again", r.Domain, r.Previous, r.IP)
+	case Created:
+		return fmt.Sprintf("Created %q pointing to %s", r.Domain, r.IP)
+	default:
+		return fmt.Sprintf("could not update %q: %s", r.Domain, r.Err)
+	}
+}
+
+func (r Result) fail(err error) Result {
+	r.Action = Failed
+	r.Err = err
+	return r
+}
@@ -0,0 +1,596 @@
+package updater_test
+
+import (
+	"cloudflare-ddns/pkg/cache"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/config"
+	"cloudflare-ddns/pkg/history"
+	"cloudflare-ddns/pkg/ip"
+	"cloudflare-ddns/pkg/journal"
+	"cloudflare-ddns/pkg/rfc2136"
+	"cloudflare-ddns/pkg/test"
+	"cloudflare-ddns/pkg/updater"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memCache map[string]cache.Entry
+
+func (c memCache) GetRecord(domain, recordType string) (cache.Entry, error) {
+	e, ok := c[domain+"-"+recordType]
+	if !ok {
+		return e, fmt.Errorf("no cached record for %q", domain)
+	}
+
+	return e, nil
+}
+
+func (c memCache) SaveRecord(e cache.Entry) error {
+	c[e.Name+"-"+string(e.Type)] = e
+	return nil
+}
+
+const managedByRouter = "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host router"
+
+func TestUpdater_Update(t *testing.T) {
+	tests := []struct {
+		name        string
+		ips         []test.IPStep
+		cached      string
+		cachedErr   string
+		verified    time.Duration // verified is how long ago the cached record was verified.
+		records     []cloudflare.Record
+		token       string
+		configure   func(cfg *config.Configuration)
+		wantAction  updater.Action
+		wantErr     string
+		wantRecords map[string]string // wantRecords maps record content to the expected owner, "" for unmanaged.
+		wantCached  string
+		wantFailure string // wantFailure is expected in the error of the cached record.
+	}{
+		{
+			name:       "unchanged IP according to the cache skips CloudFlare",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.2",
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter}},
+			wantAction: updater.Skipped,
+			wantRecords: map[string]string{
+				"192.168.0.1": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "unchanged IP is updated again if the cached update failed",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.2",
+			cachedErr:  "could not update record: timeout",
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter}},
+			wantAction: updater.Updated,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "unchanged IP is updated again if the TTL changed",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.2",
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2", Proxied: true, TTL: 1, Comment: managedByRouter}},
+			configure:  func(cfg *config.Configuration) { cfg.CloudFlare.TTL = 300 },
+			wantAction: updater.Updated,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "record changed outside of the updater is corrected once the reconcile interval passed",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.2",
+			verified:   2 * time.Hour,
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter}},
+			configure:  func(cfg *config.Configuration) { cfg.App.Reconcile = time.Hour },
+			wantAction: updater.Reconciled,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "record changed outside of the updater is trusted until the reconcile interval passed",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.2",
+			verified:   10 * time.Minute,
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter}},
+			configure:  func(cfg *config.Configuration) { cfg.App.Reconcile = time.Hour },
+			wantAction: updater.Skipped,
+			wantRecords: map[string]string{
+				"192.168.0.1": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "reconciled record without changes is left alone",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.2",
+			verified:   2 * time.Hour,
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2", Proxied: true, TTL: 1, Comment: managedByRouter}},
+			configure:  func(cfg *config.Configuration) { cfg.App.Reconcile = time.Hour },
+			wantAction: updater.Unchanged,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "managed record is updated to the new IP",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.1",
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter}},
+			wantAction: updater.Updated,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "managed record already pointing to the IP is left alone",
+			ips:        test.IPs("192.168.0.1"),
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Proxied: true, Comment: managedByRouter}},
+			wantAction: updater.Unchanged,
+			wantRecords: map[string]string{
+				"192.168.0.1": "router",
+			},
+			wantCached: "192.168.0.1",
+		},
+		{
+			name:       "unmanaged record is refused",
+			ips:        test.IPs("192.168.0.2"),
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1"}},
+			wantAction: updater.Failed,
+			wantErr:    "-adopt",
+			wantRecords: map[string]string{
+				"192.168.0.1": "",
+			},
+		},
+		{
+			name:       "refused update is kept in the cache",
+			ips:        test.IPs("192.168.0.2"),
+			cached:     "192.168.0.1",
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1"}},
+			wantAction: updater.Failed,
+			wantErr:    "-adopt",
+			wantRecords: map[string]string{
+				"192.168.0.1": "",
+			},
+			wantCached:  "192.168.0.1",
+			wantFailure: "-adopt",
+		},
+		{
+			name:       "unmanaged record is adopted",
+			ips:        test.IPs("192.168.0.2"),
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1"}},
+			configure:  func(cfg *config.Configuration) { cfg.CloudFlare.Adopt = true },
+			wantAction: updater.Updated,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name:       "record owned by another host is refused",
+			ips:        test.IPs("192.168.0.2"),
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Tags: []string{"cloudflare-ddns:laptop"}}},
+			configure:  func(cfg *config.Configuration) { cfg.CloudFlare.Adopt = true },
+			wantAction: updater.Failed,
+			wantErr:    "-force",
+			wantRecords: map[string]string{
+				"192.168.0.1": "laptop",
+			},
+		},
+		{
+			name:    "record owned by another host is taken over when forced",
+			ips:     test.IPs("192.168.0.2"),
+			records: []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Tags: []string{"cloudflare-ddns:laptop"}}},
+			configure: func(cfg *config.Configuration) {
+				cfg.CloudFlare.Force = true
+				cfg.CloudFlare.Tag = true
+			},
+			wantAction: updater.Updated,
+			wantRecords: map[string]string{
+				"192.168.0.2": "router",
+			},
+			wantCached: "192.168.0.2",
+		},
+		{
+			name: "duplicate records fail outside of record set mode",
+			ips:  test.IPs("192.168.0.3"),
+			records: []cloudflare.Record{
+				{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter},
+				{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2"},
+			},
+			wantAction: updater.Failed,
+			wantErr:    "duplicate",
+			wantRecords: map[string]string{
+				"192.168.0.1": "router",
+				"192.168.0.2": "",
+			},
+		},
+		{
+			name: "own entry of a record set is updated",
+			ips:  test.IPs("192.168.0.3"),
+			records: []cloudflare.Record{
+				{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter},
+				{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2"},
+			},
+			configure:  func(cfg *config.Configuration) { cfg.CloudFlare.RecordSet = true },
+			wantAction: updater.Updated,
+			wantRecords: map[string]string{
+				"192.168.0.3": "router",
+				"192.168.0.2": "",
+			},
+			wantCached: "192.168.0.3",
+		},
+		{
+			name: "missing entry of a record set is created",
+			ips:  test.IPs("192.168.0.3"),
+			records: []cloudflare.Record{
+				{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Tags: []string{"cloudflare-ddns:laptop"}},
+				{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2"},
+			},
+			configure:  func(cfg *config.Configuration) { cfg.CloudFlare.RecordSet = true },
+			wantAction: updater.Created,
+			wantRecords: map[string]string{
+				"192.168.0.1": "laptop",
+				"192.168.0.2": "",
+				"192.168.0.3": "router",
+			},
+			wantCached: "192.168.0.3",
+		},
+		{
+			name:       "failing IP retrieval does not touch CloudFlare",
+			ips:        []test.IPStep{{Err: errors.New("no route to host")}},
+			records:    []cloudflare.Record{{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter}},
+			wantAction: updater.Failed,
+			wantErr:    "no route to host",
+			wantRecords: map[string]string{
+				"192.168.0.1": "router",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fake := test.NewCloudFlare("token")
+			defer fake.Close()
+			for _, rec := range tt.records {
+				fake.AddRecord(rec)
+			}
+
+			token := tt.token
+			if token == "" {
+				token = "token"
+			}
+			client, err := cloudflare.NewClient(cloudflare.Token(token), cloudflare.BaseURL(fake.URL()))
+			if err != nil {
+				t.Fatalf("could not create client: %s", err)
+			}
+
+			mem := memCache{}
+			if tt.cached != "" {
+				mem["home.nenad.dev-A"] = cache.Entry{Name: "home.nenad.dev", Type: cloudflare.A, Content: tt.cached, TTL: 1, Proxied: true, Error: tt.cachedErr, Verified: time.Now().Add(-tt.verified)}
+			}
+
+			cfg := config.Configuration{CloudFlare: config.CloudFlare{
+				Domain:    "home.nenad.dev",
+				Type:      "A",
+				Proxied:   true,
+				TTL:       1,
+				IPVersion: ip.V4,
+				Owner:     "router",
+				Comment:   true,
+			}}
+			if tt.configure != nil {
+				tt.configure(&cfg)
+			}
+
+			retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: tt.ips})
+			res := updater.New(retriever, mem, client, cfg).Update(context.Background())
+
+			if res.Action != tt.wantAction {
+				t.Errorf("want action %q, got %q (%v)", tt.wantAction, res.Action, res.Err)
+			}
+			if tt.wantErr == "" && res.Err != nil {
+				t.Errorf("did not expect an error: %s", res.Err)
+			}
+			if tt.wantErr != "" && (res.Err == nil || !strings.Contains(res.Err.Error(), tt.wantErr)) {
+				t.Errorf("expected error to contain %q, got %v", tt.wantErr, res.Err)
+			}
+
+			got := map[string]string{}
+			for _, rec := range fake.Records("nenad.dev") {
+				got[rec.Content], _ = rec.Owner()
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantRecords) {
+				t.Errorf("want records %v, got %v", tt.wantRecords, got)
+			}
+
+			cached := mem["home.nenad.dev-A"]
+			if cached.Content != tt.wantCached && tt.wantCached != "" {
+				t.Errorf("want cached content %q, got %q", tt.wantCached, cached.Content)
+			}
+			if res.Action != updater.Skipped && res.Action != updater.Failed && time.Since(cached.Verified) > time.Minute {
+				t.Errorf("expected the cached record to be verified now, got %s", cached.Verified)
+			}
+			if !strings.Contains(cached.Error, tt.wantFailure) || (tt.wantFailure == "" && cached.Error != "") {
+				t.Errorf("want cached error to contain %q, got %q", tt.wantFailure, cached.Error)
+			}
+		})
+	}
+}
+
+// basicProvider hides every method but those of updater.DNSProvider.
+type basicProvider struct {
+	updater.DNSProvider
+}
+
+func TestUpdater_UpdateRecordSetRequiresListing(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	cfg := config.Configuration{CloudFlare: config.CloudFlare{
+		Domain:    "home.nenad.dev",
+		Type:      "A",
+		IPVersion: ip.V4,
+		Owner:     "router",
+		Comment:   true,
+		RecordSet: true,
+	}}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2")})
+	res := updater.New(retriever, memCache{}, basicProvider{client}, cfg).Update(context.Background())
+
+	if res.Action != updater.Failed || res.Err == nil || !strings.Contains(res.Err.Error(), "record sets") {
+		t.Errorf("expected record set mode to fail, got %q (%v)", res.Action, res.Err)
+	}
+	if reqs := fake.Requests(); len(reqs) != 0 {
+		t.Errorf("expected no requests to CloudFlare, got %v", reqs)
+	}
+}
+
+func TestUpdater_UpdateRFC2136(t *testing.T) {
+	ns, err := test.NewNameserver("nenad.lan", "ddns-key", "c2VjcmV0")
+	if err != nil {
+		t.Fatalf("could not start name server: %s", err)
+	}
+	defer ns.Close()
+	if err := ns.Add("home.nenad.lan. 300 IN A 192.168.0.1"); err != nil {
+		t.Fatalf("could not add record: %s", err)
+	}
+
+	client, err := rfc2136.NewClient(ns.Addr(), rfc2136.TSIG("ddns-key", "c2VjcmV0", ""))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	cfg := config.Configuration{
+		CloudFlare: config.CloudFlare{
+			Domain:    "home.nenad.lan",
+			Type:      "A",
+			TTL:       rfc2136.DefaultTTL,
+			IPVersion: ip.V4,
+			Owner:     "router",
+			Comment:   true,
+			Adopt:     true,
+		},
+		App: config.App{Provider: config.ProviderRFC2136, Preflight: true},
+	}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2", "192.168.0.2")})
+
+	res := updater.New(retriever, memCache{}, client, cfg).Update(context.Background())
+	if res.Action != updater.Updated || res.Err != nil {
+		t.Fatalf("expected the record to be adopted, got %q (%v)", res.Action, res.Err)
+	}
+
+	// Without a cache, the second run finds the record marked by the TXT record and pointing to the IP.
+	res = updater.New(retriever, memCache{}, client, cfg).Update(context.Background())
+	if res.Action != updater.Unchanged || res.Err != nil {
+		t.Fatalf("expected the record to be unchanged, got %q (%v)", res.Action, res.Err)
+	}
+
+	records := ns.Records("home.nenad.lan")
+	if len(records) != 2 || records[0] != "home.nenad.lan. 300 IN A 192.168.0.2" || !strings.Contains(records[1], "from host router") {
+		t.Errorf("unexpected records %q", records)
+	}
+}
+
+func TestUpdater_UpdateJournalsChangesAndRecordsHistory(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	j := journal.New(path.Join(dir, journal.Filename))
+	h := history.New(dir)
+
+	cfg := config.Configuration{CloudFlare: config.CloudFlare{Domain: "home.nenad.dev", Type: "A", IPVersion: ip.V4, Owner: "router", Comment: true}}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2", "192.168.0.2")})
+	u := updater.New(retriever, &cache.NoopCache{}, client, cfg, updater.Journal(j), updater.History(h))
+	for _, want := range []updater.Action{updater.Updated, updater.Unchanged} {
+		if res := u.Update(context.Background()); res.Action != want || res.Err != nil {
+			t.Fatalf("want action %q, got %q (%v)", want, res.Action, res.Err)
+		}
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		t.Fatalf("could not read journal: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "home.nenad.dev" || entries[0].Old != "192.168.0.1" || entries[0].New != "192.168.0.2" {
+		t.Errorf("expected a single journaled update, got %v", entries)
+	}
+
+	events, err := h.Events(history.Query{Domain: "home.nenad.dev"})
+	if err != nil {
+		t.Fatalf("could not read history: %s", err)
+	}
+	if len(events) != 2 || events[0].Action != "updated" || events[0].Previous != "192.168.0.1" || events[1].Action != "unchanged" || events[1].IP != "192.168.0.2" {
+		t.Errorf("expected the update and the unchanged check in the history, got %v", events)
+	}
+}
+
+// lockedCache is a cache whose records are locked by another process.
+type lockedCache struct {
+	memCache
+}
+
+func (lockedCache) Lock(domain, recordType string) (func() error, error) {
+	return nil, cache.ErrLocked
+}
+
+func TestUpdater_UpdateLockedRecord(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	cfg := config.Configuration{CloudFlare: config.CloudFlare{Domain: "home.nenad.dev", Type: "A", IPVersion: ip.V4, Owner: "router", Comment: true}}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2")})
+	res := updater.New(retriever, lockedCache{memCache{}}, client, cfg).Update(context.Background())
+
+	if res.Action != updater.Skipped || !res.Locked || res.Err != nil {
+		t.Errorf("expected the locked record to be skipped, got %q (%v)", res.Action, res.Err)
+	}
+	if want := `"home.nenad.dev" is being updated by another process, skipping update`; res.String() != want {
+		t.Errorf("want %q, got %q", want, res.String())
+	}
+	if reqs := fake.Requests(); len(reqs) != 0 {
+		t.Errorf("expected no requests to CloudFlare, got %v", reqs)
+	}
+}
+
+func TestUpdater_UpdateCachesPublishedRecord(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Proxied: true, TTL: 1, Comment: managedByRouter})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	cfg := config.Configuration{CloudFlare: config.CloudFlare{Domain: "home.nenad.dev", Type: "A", Proxied: true, TTL: 1, IPVersion: ip.V4, Owner: "router", Comment: true}}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2", "192.168.0.2")})
+	mem := memCache{}
+
+	// The cache holds the record as it was published by the update, not as it was read before it.
+	res := updater.New(retriever, mem, client, cfg).Update(context.Background())
+	published := fake.Records("nenad.dev")[0]
+	if cached := mem["home.nenad.dev-A"]; res.Action != updater.Updated || cached.Content != "192.168.0.2" || cached.RecordID != published.ID || cached.ZoneID != published.ZoneID {
+		t.Fatalf("expected the published record %#v to be cached, got %#v after %q (%v)", published, cached, res.Action, res.Err)
+	}
+	if res.Previous != "192.168.0.1" {
+		t.Errorf("expected the content before the update to be reported, got %q", res.Previous)
+	}
+
+	// A record that already points to the IP is not patched again, even without a cached record.
+	delete(mem, "home.nenad.dev-A")
+	before := len(fake.Requests())
+	res = updater.New(retriever, mem, client, cfg).Update(context.Background())
+	if res.Action != updater.Unchanged || res.Err != nil {
+		t.Fatalf("expected the record to be unchanged, got %q (%v)", res.Action, res.Err)
+	}
+	for _, req := range fake.Requests()[before:] {
+		if strings.HasPrefix(req, "PATCH") {
+			t.Errorf("expected no update of the unchanged record, got %q", req)
+		}
+	}
+	if cached := mem["home.nenad.dev-A"]; cached.Content != "192.168.0.2" || cached.RecordID != published.ID {
+		t.Errorf("expected the unchanged record to be cached, got %#v", cached)
+	}
+}
+
+func TestUpdater_UpdateKeepsTagOrder(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Proxied: true, TTL: 1, Tags: []string{"a:b", "cloudflare-ddns:router"}})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	cfg := config.Configuration{CloudFlare: config.CloudFlare{Domain: "home.nenad.dev", Type: "A", Proxied: true, TTL: 1, IPVersion: ip.V4, Owner: "router", Tag: true}}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.1")})
+	res := updater.New(retriever, memCache{}, client, cfg).Update(context.Background())
+
+	if res.Action != updater.Unchanged || res.Err != nil {
+		t.Fatalf("expected the tagged record to be unchanged, got %q (%v)", res.Action, res.Err)
+	}
+	for _, req := range fake.Requests() {
+		if strings.HasPrefix(req, "PATCH") {
+			t.Errorf("expected no update of the unchanged record, got %q", req)
+		}
+	}
+}
+
+func TestUpdater_UpdateLocksWithoutCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflare-ddns")
+	if err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", Comment: managedByRouter})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	// Another run holds the lock of the record.
+	unlock, err := cache.New(dir).Lock("home.nenad.dev", "A")
+	if err != nil {
+		t.Fatalf("could not lock record: %s", err)
+	}
+	defer unlock()
+
+	cfg := config.Configuration{CloudFlare: config.CloudFlare{Domain: "home.nenad.dev", Type: "A", IPVersion: ip.V4, Owner: "router", Comment: true}}
+	retriever := test.NewIPSequence(map[ip.Version][]test.IPStep{ip.V4: test.IPs("192.168.0.2")})
+	res := updater.New(retriever, &cache.NoopCache{}, client, cfg, updater.Lock(cache.New(dir))).Update(context.Background())
+
+	if res.Action != updater.Skipped || !res.Locked {
+		t.Errorf("expected the locked record to be skipped without a cache, got %q (%v)", res.Action, res.Err)
+	}
+	if reqs := fake.Requests(); len(reqs) != 0 {
+		t.Errorf("expected no requests to CloudFlare, got %v", reqs)
+	}
+}
@@ -0,0 +1,145 @@
+package zone
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// FormatTable writes the records as an aligned table for reading.
+	FormatTable = "table"
+	// FormatJSON writes the records as returned by CloudFlare.
+	FormatJSON = "json"
+	// FormatBIND writes the records as a BIND zone file.
+	FormatBIND = "bind"
+)
+
+// Lister is implemented by DNS providers that can list the records of a zone.
+type Lister interface {
+	ListRecords(ctx context.Context, zone string, filter cloudflare.RecordFilter) ([]cloudflare.Record, error)
+}
+
+// Write writes the records of the zone in the format. Records are sorted by name, type and content,
+// so the output of unchanged zones can be diffed.
+func Write(w io.Writer, zone string, recs []cloudflare.Record, format string) error {
+	recs = append([]cloudflare.Record(nil), recs...)
+	Sort(recs)
+
+	switch format {
+	case FormatTable:
+		return writeTable(w, recs)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if recs == nil {
+			recs = []cloudflare.Record{}
+		}
+		return enc.Encode(recs)
+	case FormatBIND:
+		return writeBIND(w, zone, recs)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// Sort sorts the records by name, type and content.
+func Sort(recs []cloudflare.Record) {
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Name != recs[j].Name {
+			return recs[i].Name < recs[j].Name
+		}
+		if recs[i].Type != recs[j].Type {
+			return recs[i].Type < recs[j].Type
+		}
+		return recs[i].Content < recs[j].Content
+	})
+}
+
+func writeTable(w io.Writer, recs []cloudflare.Record) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tTYPE\tCONTENT\tTTL\tPROXIED\tOWNER")
+	for _, rec := range recs {
+		ttl := strconv.Itoa(rec.TTL)
+		if rec.TTL == 1 {
+			ttl = "auto"
+		}
+
+		owner, managed := rec.Owner()
+		if !managed {
+			owner = "-"
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\n", rec.Name, rec.Type, rec.Content, ttl, rec.Proxied, owner)
+	}
+
+	return tw.Flush()
+}
+
+// writeBIND writes the records as CloudFlare's own BIND export does, with absolute names.
+// The comment of a record, its proxying and tags follow the record as a comment, such as
+// "; managed by cloudflare-ddns cf_tags=cf-proxied:true,cloudflare-ddns:router".
+func writeBIND(w io.Writer, zone string, recs []cloudflare.Record) error {
+	if _, err := fmt.Fprintf(w, "$ORIGIN %s.\n", strings.TrimSuffix(zone, ".")); err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		line := fmt.Sprintf("%s.\t%d\tIN\t%s\t%s", rec.Name, rec.TTL, rec.Type, bindContent(rec))
+
+		var trailer []string
+		if rec.Comment != "" {
+			trailer = append(trailer, rec.Comment)
+		}
+		if rec.Proxiable || rec.Proxied || len(rec.Tags) > 0 {
+			tags := append([]string{fmt.Sprintf("cf-proxied:%t", rec.Proxied)}, rec.Tags...)
+			trailer = append(trailer, cfTags+strings.Join(tags, ","))
+		}
+		if len(trailer) > 0 {
+			line += " ; " + strings.Join(trailer, " ")
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cfTags starts the proxying and tags of a record in the comment of a BIND record.
+const cfTags = "cf_tags="
+
+// bindContent returns the content of the record in zone file syntax.
+func bindContent(rec cloudflare.Record) string {
+	priority := 0
+	if rec.Priority != nil {
+		priority = int(*rec.Priority)
+	}
+
+	switch rec.Type {
+	case cloudflare.CNAME, "NS", "PTR":
+		return absolute(rec.Content)
+	case cloudflare.MX:
+		return fmt.Sprintf("%d %s", priority, absolute(rec.Content))
+	case "SRV", "URI":
+		return fmt.Sprintf("%d %s", priority, rec.Content)
+	case cloudflare.TXT, "SPF":
+		if strings.HasPrefix(rec.Content, `"`) {
+			return rec.Content
+		}
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(rec.Content) + `"`
+	default:
+		return rec.Content
+	}
+}
+
+func absolute(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
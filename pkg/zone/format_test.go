@@ -0,0 +1,84 @@
+package zone_test
+
+import (
+	"bytes"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/zone"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func fixtureRecords() []cloudflare.Record {
+	priority := uint16(10)
+	return []cloudflare.Record{
+		{ID: "3", Name: "nenad.dev", Type: cloudflare.TXT, Content: `v=spf1 include:"_spf.nenad.dev" -all`, TTL: 3600},
+		{ID: "1", Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", TTL: 1, Proxiable: true, Proxied: true,
+			Comment: "managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host router", Tags: []string{"cloudflare-ddns:router"}},
+		{ID: "2", Name: "nenad.dev", Type: cloudflare.MX, Content: "mail.nenad.dev", Priority: &priority, TTL: 300},
+		{ID: "4", Name: "www.nenad.dev", Type: cloudflare.CNAME, Content: "nenad.dev", TTL: 1, Proxiable: true},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "table",
+			format: zone.FormatTable,
+			want: "NAME            TYPE   CONTENT                               TTL   PROXIED  OWNER\n" +
+				"home.nenad.dev  A      192.168.0.1                           auto  true     router\n" +
+				"nenad.dev       MX     mail.nenad.dev                        300   false    -\n" +
+				"nenad.dev       TXT    v=spf1 include:\"_spf.nenad.dev\" -all  3600  false    -\n" +
+				"www.nenad.dev   CNAME  nenad.dev                             auto  false    -\n",
+		},
+		{
+			name:   "bind",
+			format: zone.FormatBIND,
+			want: "$ORIGIN nenad.dev.\n" +
+				"home.nenad.dev.\t1\tIN\tA\t192.168.0.1 ; managed by cloudflare-ddns, updated 2026-10-18T12:00Z from host router cf_tags=cf-proxied:true,cloudflare-ddns:router\n" +
+				"nenad.dev.\t300\tIN\tMX\t10 mail.nenad.dev.\n" +
+				"nenad.dev.\t3600\tIN\tTXT\t\"v=spf1 include:\\\"_spf.nenad.dev\\\" -all\"\n" +
+				"www.nenad.dev.\t1\tIN\tCNAME\tnenad.dev. ; cf_tags=cf-proxied:false\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := zone.Write(b, "nenad.dev", fixtureRecords(), tt.format); err != nil {
+				t.Fatalf("could not write records: %s", err)
+			}
+
+			if b.String() != tt.want {
+				t.Errorf("want output\n%s\ngot\n%s", tt.want, b.String())
+			}
+		})
+	}
+}
+
+func TestWrite_JSON(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := zone.Write(b, "nenad.dev", fixtureRecords(), zone.FormatJSON); err != nil {
+		t.Fatalf("could not write records: %s", err)
+	}
+
+	var got []cloudflare.Record
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("could not decode output: %s", err)
+	}
+
+	want := fixtureRecords()
+	zone.Sort(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want records %#v, got %#v", want, got)
+	}
+
+	b.Reset()
+	if err := zone.Write(b, "nenad.dev", nil, zone.FormatJSON); err != nil || b.String() != "[]\n" {
+		t.Errorf("expected an empty list for no records, got %q (%v)", b.String(), err)
+	}
+}
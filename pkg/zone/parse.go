@@ -0,0 +1,118 @@
+package zone
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Read reads the records of the zone written by Write in the JSON or BIND format.
+// Records with names outside of the zone are rejected, so a snapshot of one zone
+// cannot be restored into another by mistake.
+func Read(r io.Reader, zone string, format string) ([]cloudflare.Record, error) {
+	var recs []cloudflare.Record
+	switch format {
+	case FormatJSON:
+		if err := json.NewDecoder(r).Decode(&recs); err != nil {
+			return nil, fmt.Errorf("could not decode records: %w", err)
+		}
+	case FormatBIND:
+		var err error
+		if recs, err = readBIND(r, zone); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	zone = strings.TrimSuffix(zone, ".")
+	for _, rec := range recs {
+		if rec.Name != zone && !strings.HasSuffix(rec.Name, "."+zone) {
+			return nil, fmt.Errorf("record %s %s is not in zone %q", rec.Name, rec.Type, zone)
+		}
+	}
+
+	return recs, nil
+}
+
+// readBIND reads a zone file, taking comments, proxying and tags from the comments written by writeBIND.
+func readBIND(r io.Reader, zone string) ([]cloudflare.Record, error) {
+	var recs []cloudflare.Record
+	zp := dns.NewZoneParser(r, dns.Fqdn(zone), "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		hdr := rr.Header()
+		rec := cloudflare.Record{
+			Name: strings.TrimSuffix(hdr.Name, "."),
+			Type: cloudflare.Type(dns.TypeToString[hdr.Rrtype]),
+			TTL:  int(hdr.Ttl),
+		}
+
+		switch rr := rr.(type) {
+		case *dns.A:
+			rec.Content = rr.A.String()
+		case *dns.AAAA:
+			rec.Content = rr.AAAA.String()
+		case *dns.CNAME:
+			rec.Content = strings.TrimSuffix(rr.Target, ".")
+		case *dns.NS:
+			rec.Content = strings.TrimSuffix(rr.Ns, ".")
+		case *dns.PTR:
+			rec.Content = strings.TrimSuffix(rr.Ptr, ".")
+		case *dns.MX:
+			rec.Content = strings.TrimSuffix(rr.Mx, ".")
+			rec.Priority = &rr.Preference
+		case *dns.TXT:
+			rec.Content = unquote(rr.Txt)
+		case *dns.SPF:
+			rec.Content = unquote(rr.Txt)
+		case *dns.SRV:
+			rec.Content = fmt.Sprintf("%d %d %s", rr.Weight, rr.Port, strings.TrimSuffix(rr.Target, "."))
+			rec.Priority = &rr.Priority
+		default:
+			rec.Content = strings.TrimPrefix(rr.String(), hdr.String())
+		}
+
+		rec.Comment, rec.Proxied, rec.Tags = parseComment(zp.Comment())
+		recs = append(recs, rec)
+	}
+
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("could not parse zone file: %w", err)
+	}
+
+	return recs, nil
+}
+
+// parseComment splits the comment of a BIND record into the record comment, its proxying and tags.
+func parseComment(comment string) (string, bool, []string) {
+	comment = strings.TrimSpace(strings.TrimPrefix(comment, ";"))
+
+	i := strings.Index(comment, cfTags)
+	if i < 0 {
+		return comment, false, nil
+	}
+
+	proxied := false
+	var tags []string
+	for _, tag := range strings.Split(comment[i+len(cfTags):], ",") {
+		if value := strings.TrimPrefix(tag, "cf-proxied:"); value != tag {
+			proxied, _ = strconv.ParseBool(value)
+			continue
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return strings.TrimSpace(comment[:i]), proxied, tags
+}
+
+// unquote joins the character strings of a TXT record, removing the escapes of writeBIND.
+func unquote(txt []string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(strings.Join(txt, ""))
+}
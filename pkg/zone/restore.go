@@ -0,0 +1,168 @@
+package zone
+
+import (
+	"cloudflare-ddns/pkg/cloudflare"
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Create means the record is in the snapshot but not in the zone.
+	Create Action = "create"
+	// Update means the record of the zone differs from the snapshot.
+	Update Action = "update"
+	// Delete means the record is in the zone but not in the snapshot.
+	Delete Action = "delete"
+)
+
+type (
+	// Action is what a change does to a record of the zone.
+	Action string
+
+	// Change is a single change restoring a record of the zone to the snapshot.
+	Change struct {
+		Action  Action
+		Current cloudflare.Record           // Current record of the zone, empty for Create.
+		Desired cloudflare.Record           // Desired record of the snapshot, empty for Delete.
+		Request cloudflare.DNSUpdateRequest // Request creating or updating the record, empty for Delete.
+	}
+
+	// Restorer is implemented by DNS providers that can change any record of a zone.
+	Restorer interface {
+		Lister
+		CreateRecord(ctx context.Context, request cloudflare.DNSUpdateRequest) (cloudflare.Record, error)
+		UpdateRecord(ctx context.Context, rec cloudflare.Record, request cloudflare.DNSUpdateRequest) error
+		DeleteRecord(ctx context.Context, rec cloudflare.Record) error
+	}
+)
+
+// Plan returns the changes turning the current records of a zone into the desired ones.
+// Records are matched by their ID, then by name, type and content, and finally by name and type,
+// so a record whose content changed is updated instead of being deleted and created again.
+func Plan(current, desired []cloudflare.Record) []Change {
+	matched := make([]bool, len(current))
+	pairs := make([]int, len(desired))
+	for i := range pairs {
+		pairs[i] = -1
+	}
+
+	match := func(same func(cur, want cloudflare.Record) bool) {
+		for i, want := range desired {
+			if pairs[i] >= 0 {
+				continue
+			}
+			for j, cur := range current {
+				if !matched[j] && same(cur, want) {
+					pairs[i], matched[j] = j, true
+					break
+				}
+			}
+		}
+	}
+	match(func(cur, want cloudflare.Record) bool { return want.ID != "" && cur.ID == want.ID })
+	match(func(cur, want cloudflare.Record) bool {
+		return cur.Name == want.Name && cur.Type == want.Type && cur.Content == want.Content
+	})
+	match(func(cur, want cloudflare.Record) bool { return cur.Name == want.Name && cur.Type == want.Type })
+
+	var changes []Change
+	for j, cur := range current {
+		if !matched[j] {
+			changes = append(changes, Change{Action: Delete, Current: cur})
+		}
+	}
+
+	for i, want := range desired {
+		if pairs[i] < 0 {
+			changes = append(changes, Change{Action: Create, Desired: want, Request: cloudflare.Diff(cloudflare.Record{}, want)})
+			continue
+		}
+
+		cur := current[pairs[i]]
+		if req := cloudflare.Diff(cur, want); !req.IsEmpty() {
+			changes = append(changes, Change{Action: Update, Current: cur, Desired: want, Request: req})
+		}
+	}
+
+	return changes
+}
+
+// Apply applies the changes to the zone, updating and creating records before deleting others,
+// so a failure part way through never leaves the zone with fewer records than it had.
+// Replacing a record by a CNAME of the same name therefore fails, as CloudFlare refuses the conflict,
+// and requires deleting the record first. It stops at the first change that fails, returning
+// the number of applied changes.
+func Apply(ctx context.Context, r Restorer, changes []Change) (int, error) {
+	applied := 0
+	for _, action := range []Action{Update, Create, Delete} {
+		for _, c := range changes {
+			if c.Action != action {
+				continue
+			}
+
+			var err error
+			switch c.Action {
+			case Delete:
+				err = r.DeleteRecord(ctx, c.Current)
+			case Update:
+				err = r.UpdateRecord(ctx, c.Current, c.Request)
+			case Create:
+				_, err = r.CreateRecord(ctx, c.Request)
+			}
+			if err != nil {
+				rec := c.Current
+				if c.Action == Create {
+					rec = c.Desired
+				}
+				return applied, fmt.Errorf("could not %s %s record %q: %w", c.Action, rec.Type, rec.Name, err)
+			}
+
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// String describes the change as a line of a diff, such as
+// "~ home.nenad.dev A 192.168.0.1 (content: 192.168.0.2, ttl: 300)".
+func (c Change) String() string {
+	switch c.Action {
+	case Create:
+		return fmt.Sprintf("+ %s %s %s", c.Desired.Name, c.Desired.Type, c.Desired.Content)
+	case Delete:
+		return fmt.Sprintf("- %s %s %s", c.Current.Name, c.Current.Type, c.Current.Content)
+	}
+
+	var fields []string
+	if c.Request.Name != "" {
+		fields = append(fields, "name: "+c.Request.Name)
+	}
+	if c.Request.Type != "" {
+		fields = append(fields, "type: "+string(c.Request.Type))
+	}
+	if c.Request.Content != "" {
+		fields = append(fields, "content: "+c.Request.Content)
+	}
+	if c.Request.Priority != nil {
+		fields = append(fields, fmt.Sprintf("priority: %d", *c.Request.Priority))
+	}
+	if c.Request.Data != nil {
+		fields = append(fields, "data")
+	}
+	if c.Request.Proxied != nil {
+		fields = append(fields, fmt.Sprintf("proxied: %t", *c.Request.Proxied))
+	}
+	if c.Request.TTL != 0 {
+		fields = append(fields, fmt.Sprintf("ttl: %d", c.Request.TTL))
+	}
+	if c.Request.Comment != nil {
+		fields = append(fields, fmt.Sprintf("comment: %q", *c.Request.Comment))
+	}
+	if c.Request.Tags != nil {
+		fields = append(fields, "tags: "+strings.Join(*c.Request.Tags, ","))
+	}
+
+	return fmt.Sprintf("~ %s %s %s (%s)", c.Current.Name, c.Current.Type, c.Current.Content, strings.Join(fields, ", "))
+}
@@ -0,0 +1,129 @@
+package zone_test
+
+import (
+	"bytes"
+	"cloudflare-ddns/pkg/cloudflare"
+	"cloudflare-ddns/pkg/test"
+	"cloudflare-ddns/pkg/zone"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	for _, format := range []string{zone.FormatJSON, zone.FormatBIND} {
+		t.Run(format, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := zone.Write(b, "nenad.dev", fixtureRecords(), format); err != nil {
+				t.Fatalf("could not write records: %s", err)
+			}
+
+			got, err := zone.Read(b, "nenad.dev", format)
+			if err != nil {
+				t.Fatalf("could not read records: %s", err)
+			}
+
+			want := fixtureRecords()
+			zone.Sort(want)
+			if changes := zone.Plan(want, got); len(changes) != 0 || len(got) != len(want) {
+				t.Errorf("want records %#v, got %#v (changes %v)", want, got, changes)
+			}
+		})
+	}
+}
+
+func TestRead_RejectsOtherZones(t *testing.T) {
+	snapshot := "$ORIGIN nenad.dev.\nhome.nenad.dev.\t300\tIN\tA\t192.168.0.1\nnenad.io.\t300\tIN\tA\t192.168.0.2\n"
+	if _, err := zone.Read(strings.NewReader(snapshot), "nenad.dev", zone.FormatBIND); err == nil || !strings.Contains(err.Error(), "nenad.io") {
+		t.Fatalf("expected an error for the record outside of the zone, got %v", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	current := []cloudflare.Record{
+		{ID: "1", Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2", TTL: 1},
+		{ID: "2", Name: "nenad.dev", Type: cloudflare.TXT, Content: "unchanged", TTL: 1},
+		{ID: "3", Name: "old.nenad.dev", Type: cloudflare.CNAME, Content: "nenad.dev", TTL: 1},
+	}
+	desired := []cloudflare.Record{
+		{Name: "nenad.dev", Type: cloudflare.TXT, Content: "unchanged", TTL: 1},
+		{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", TTL: 300},
+		{Name: "new.nenad.dev", Type: cloudflare.CNAME, Content: "nenad.dev", TTL: 1},
+	}
+
+	var got []string
+	for _, c := range zone.Plan(current, desired) {
+		got = append(got, c.String())
+	}
+
+	want := []string{
+		"- old.nenad.dev CNAME nenad.dev",
+		"~ home.nenad.dev A 192.168.0.2 (content: 192.168.0.1, ttl: 300)",
+		"+ new.nenad.dev CNAME nenad.dev",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want changes %q, got %q", want, got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "home.nenad.dev", Type: cloudflare.A, Content: "192.168.0.2"})
+	fake.AddRecord(cloudflare.Record{Name: "www.nenad.dev", Type: cloudflare.A, Content: "192.168.0.3"})
+	// Tags the snapshot does not have are removed.
+	fake.AddRecord(cloudflare.Record{Name: "nenad.dev", Type: cloudflare.TXT, Content: `v=spf1 include:"_spf.nenad.dev" -all`, TTL: 3600, Tags: []string{"env:old"}})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	ctx := context.Background()
+	current, err := client.ListRecords(ctx, "nenad.dev", cloudflare.RecordFilter{})
+	if err != nil {
+		t.Fatalf("could not list records: %s", err)
+	}
+
+	want := fixtureRecords()
+	applied, err := zone.Apply(ctx, client, zone.Plan(current, want))
+	if err != nil || applied != 5 {
+		t.Fatalf("want 5 applied changes, got %d (%v)", applied, err)
+	}
+
+	restored, err := client.ListRecords(ctx, "nenad.dev", cloudflare.RecordFilter{})
+	if err != nil {
+		t.Fatalf("could not list records: %s", err)
+	}
+	if changes := zone.Plan(restored, want); len(changes) != 0 {
+		t.Errorf("expected the zone to match the snapshot, got changes %v", changes)
+	}
+}
+
+func TestApply_DeletesLast(t *testing.T) {
+	fake := test.NewCloudFlare("token")
+	defer fake.Close()
+	fake.AddRecord(cloudflare.Record{Name: "old.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1"})
+
+	client, err := cloudflare.NewClient(cloudflare.Token("token"), cloudflare.BaseURL(fake.URL()))
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+
+	ctx := context.Background()
+	current, err := client.ListRecords(ctx, "nenad.dev", cloudflare.RecordFilter{})
+	if err != nil {
+		t.Fatalf("could not list records: %s", err)
+	}
+
+	fake.Fail(test.Failure{Method: "POST", Status: 400, Code: 9000, Message: "Invalid DNS record"})
+	changes := zone.Plan(current, []cloudflare.Record{{Name: "new.nenad.dev", Type: cloudflare.A, Content: "192.168.0.1", TTL: 1}})
+	if applied, err := zone.Apply(ctx, client, changes); err == nil || applied != 0 {
+		t.Fatalf("expected the creation to fail first, got %d applied changes (%v)", applied, err)
+	}
+
+	if recs := fake.Records("nenad.dev"); len(recs) != 1 || recs[0].Name != "old.nenad.dev" {
+		t.Errorf("expected the record to be kept when the restore fails, got %v", recs)
+	}
+}